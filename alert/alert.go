@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/chenyoufu/jepl"
+	"github.com/chenyoufu/yfstream/event"
 	"github.com/chenyoufu/yfstream/g"
 	"github.com/wxjuyun/common/model"
 	"github.com/wxjuyun/common/utils"
@@ -17,7 +18,9 @@ func checkErr(err error) {
 	}
 }
 
-func Alerter(in <-chan string) {
+//Alerter judge the cooked events against the alert rules every interval,
+//an event is settled as soon as it is queued for judgement
+func Alerter(in <-chan *event.Event) {
 
 	l := make([]string, 0, 1024)
 	interval := g.Config().Alert.Interval
@@ -29,8 +32,11 @@ func Alerter(in <-chan string) {
 		case <-checker.C:
 			judge(l)
 			l = l[:0]
-		case v := <-in:
-			l = append(l, v)
+		case e := <-in:
+			if b, err := e.Bytes(); err == nil {
+				l = append(l, string(b))
+			}
+			e.Done(nil)
 		}
 	}
 }
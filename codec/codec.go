@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//DefaultMaxFrameSize bounds a decoded frame when no limit is configured
+const DefaultMaxFrameSize = 1 << 20
+
+//ErrFrameTooLarge is returned when a frame exceeds the maximum size
+var ErrFrameTooLarge = errors.New("codec: frame too large")
+
+//Codec frames messages on a byte stream
+type Codec interface {
+	Encode(w io.Writer, msg []byte) error
+	Decode(r *bufio.Reader) ([]byte, error)
+}
+
+//New returns the codec for framing: newline, octet (RFC 6587 octet counting) or length (4 bytes big endian)
+func New(framing string, maxFrameSize int) (Codec, error) {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	switch framing {
+	case "", "newline":
+		return &Newline{MaxFrameSize: maxFrameSize}, nil
+	case "octet":
+		return &OctetCounted{MaxFrameSize: maxFrameSize}, nil
+	case "length":
+		return &LengthPrefixed{MaxFrameSize: maxFrameSize}, nil
+	}
+	return nil, fmt.Errorf("codec: unknown framing %q", framing)
+}
+
+//Newline frames messages with a trailing '\n'
+type Newline struct {
+	MaxFrameSize int
+}
+
+//Encode write msg followed by '\n'
+func (c *Newline) Encode(w io.Writer, msg []byte) error {
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
+
+//Decode read up to the next '\n', a trailing '\r' is trimmed
+func (c *Newline) Decode(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		if len(line)+len(frag) > c.MaxFrameSize+1 {
+			return nil, ErrFrameTooLarge
+		}
+		line = append(line, frag...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			// the peer closed after an unterminated last line
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = line[:len(line)-1]
+		break
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+//OctetCounted frames messages as "<length> <msg>"
+type OctetCounted struct {
+	MaxFrameSize int
+}
+
+//Encode write the decimal length, a space, then msg
+func (c *OctetCounted) Encode(w io.Writer, msg []byte) error {
+	if _, err := io.WriteString(w, strconv.Itoa(len(msg))); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{' '}); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+//Decode read the decimal length then that many bytes
+func (c *OctetCounted) Decode(r *bufio.Reader) ([]byte, error) {
+	n := 0
+	digits := 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && digits > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == ' ' && digits > 0 {
+			break
+		}
+		if b < '0' || b > '9' {
+			return nil, fmt.Errorf("codec: invalid octet count byte %q", b)
+		}
+		n = n*10 + int(b-'0')
+		digits++
+		if n > c.MaxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+	}
+	return readFull(r, n)
+}
+
+//LengthPrefixed frames messages with a 4 bytes big endian length
+type LengthPrefixed struct {
+	MaxFrameSize int
+}
+
+//Encode write the length header then msg
+func (c *LengthPrefixed) Encode(w io.Writer, msg []byte) error {
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(msg)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+//Decode read the length header then that many bytes
+func (c *LengthPrefixed) Decode(r *bufio.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > uint32(c.MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+	return readFull(r, int(n))
+}
+
+func readFull(r io.Reader, n int) ([]byte, error) {
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msgs := []string{`{"type":"http"}`, ``, `{"message":"a b\tc"}`}
+	for _, framing := range []string{"newline", "octet", "length"} {
+		c, err := New(framing, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		for _, m := range msgs {
+			if err := c.Encode(&buf, []byte(m)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := bufio.NewReader(&buf)
+		for _, want := range msgs {
+			got, err := c.Decode(r)
+			if err != nil || string(got) != want {
+				t.Errorf("%s: Decode = %q, %v, but we want %q", framing, got, err, want)
+			}
+		}
+		if _, err := c.Decode(r); err != io.EOF {
+			t.Errorf("%s: Decode at end = %v, but we want EOF", framing, err)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	var tests = []struct {
+		framing string
+		input   string
+	}{
+		{"newline", "0123456789abcdef\n"},
+		{"octet", "x2 ab"},
+		{"octet", "99999 ab"},
+		{"octet", "5 ab"},
+		{"length", "\x00\x00\x01\x00ab"},
+		{"length", "\x00\x00\x00\x05ab"},
+	}
+	for _, test := range tests {
+		c, _ := New(test.framing, 8)
+		if got, err := c.Decode(bufio.NewReader(bytes.NewBufferString(test.input))); err == nil {
+			t.Errorf("%s: Decode(%q) = %q, but we want an error", test.framing, test.input, got)
+		}
+	}
+
+	if _, err := New("netstring", 0); err == nil {
+		t.Error("unknown framing should fail")
+	}
+}
+
+func TestNewlineCRLF(t *testing.T) {
+	c, _ := New("newline", 0)
+	r := bufio.NewReader(bytes.NewBufferString("a\r\nb\r"))
+	if got, _ := c.Decode(r); string(got) != "a" {
+		t.Errorf("Decode = %q, but we want %q", got, "a")
+	}
+	if got, _ := c.Decode(r); string(got) != "b" {
+		t.Errorf("Decode = %q, but we want the unterminated last line without its '\\r'", got)
+	}
+}
@@ -0,0 +1,103 @@
+package cook
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/ipsearch"
+)
+
+//countingLookup counts the lookups reaching the ip database
+type countingLookup struct {
+	ipsearch.IPLookup
+	n *int
+}
+
+func (c countingLookup) Lookup(ip net.IP) (ipsearch.Record, bool) {
+	*c.n++
+	return c.IPLookup.Lookup(ip)
+}
+
+func TestHandleIPCache(t *testing.T) {
+	c := newEnrichCooker(t, nil)
+	c.ipCache = newCache(g.CacheConfig{Size: 10})
+	var n int
+	c.ipdb = countingLookup{c.ipdb, &n}
+
+	for i, ip := range []interface{}{"210.51.200.123", 3526609019, "::ffff:210.51.200.123"} {
+		m, err := c.handleIP(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m["raw"] != ip || m["isp"] != "联通" {
+			t.Errorf("handleIP(%v) #%d = %v, but we want raw %v isp 联通", ip, i, m, ip)
+		}
+		// callers own the returned map
+		delete(m, "isp")
+	}
+	if n != 1 {
+		t.Errorf("ip database looked up %d times, but we want 1", n)
+	}
+	if s := c.ipCache.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("ip cache stats = %+v, but we want 2 hits and 1 miss", s)
+	}
+
+	c.ipCache.Purge()
+	c.handleIP("210.51.200.123")
+	if n != 2 {
+		t.Errorf("ip database looked up %d times after a purge, but we want 2", n)
+	}
+}
+
+func TestHandleUACache(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{UACache: g.CacheConfig{Size: 10, TTL: 60}})
+	for i := 0; i < 3; i++ {
+		m := c.handleUA("curl/7.29.0")
+		if m["raw"] != "curl/7.29.0" {
+			t.Errorf("handleUA #%d = %v, but we want raw curl/7.29.0", i, m)
+		}
+		m["raw"] = "changed"
+	}
+	if s := c.uaCache.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("ua cache stats = %+v, but we want 2 hits and 1 miss", s)
+	}
+	if c.ipCache != nil {
+		t.Errorf("ip cache should be disabled without a size")
+	}
+}
+
+func benchmarkHandleIP(b *testing.B, size int) {
+	p, err := ipsearch.New("../ipsearch/regionIp.dat")
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := &Cooker{ipdb: &ipsearch.QQZeng{V4: p}, ipCache: newCache(g.CacheConfig{Size: size})}
+	ips := make([]string, 2000)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("210.51.%d.%d", i/250, i%250+1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.handleIP(ips[i%len(ips)])
+	}
+}
+
+func BenchmarkHandleIP(b *testing.B)       { benchmarkHandleIP(b, 0) }
+func BenchmarkHandleIPCached(b *testing.B) { benchmarkHandleIP(b, 10000) }
+
+func benchmarkHandleUA(b *testing.B, size int) {
+	c := &Cooker{uaCache: newCache(g.CacheConfig{Size: size})}
+	uas := make([]string, 500)
+	for i := range uas {
+		uas[i] = fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/56.0.%d.87 Safari/537.36", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.handleUA(uas[i%len(uas)])
+	}
+}
+
+func BenchmarkHandleUA(b *testing.B)       { benchmarkHandleUA(b, 0) }
+func BenchmarkHandleUACached(b *testing.B) { benchmarkHandleUA(b, 10000) }
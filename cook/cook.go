@@ -1,21 +1,39 @@
 package cook
 
 import (
-	"github.com/bitly/go-simplejson"
+	"errors"
+	"fmt"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
 	"github.com/chenyoufu/yfstream/grok"
+	"github.com/chenyoufu/yfstream/intel"
 	"github.com/chenyoufu/yfstream/ipsearch"
-	"github.com/mssola/user_agent"
+	"github.com/chenyoufu/yfstream/lru"
 	"log"
+	"math"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 //Cooker ...
 type Cooker struct {
-	ipsearch *ipsearch.IPSearch
-	grok     *grok.Grok
+	ipdb        ipsearch.IPLookup
+	asn         ipsearch.ASNLookup
+	networks    *ipsearch.CIDRTable
+	grok        *grok.Grok
+	grokRules   []*grokRule
+	processors  []*processor
+	enrichRules []*enrichRule
+	ipCache     *lru.Cache
+	uaCache     *lru.Cache
+	ua          *uaParser
+	threat      *threatMatcher
+	ecs         g.ECSConfig
+	legacyIP    bool
 }
 
 var ipRegionFile = "regionIp.dat"
@@ -23,117 +41,429 @@ var patternsDir = "grok_patterns"
 
 //InitCooker return a Cooker
 func InitCooker() Cooker {
+	cfg := g.Config().Cook
+	if cfg == nil {
+		cfg = &g.CookConfig{}
+	}
+	dir := patternsDir
+	if len(cfg.PatternsDir) > 0 {
+		dir = cfg.PatternsDir
+	}
+
 	grokConfig := &grok.Config{
 		NamedCapturesOnly: true,
 		RemoveEmptyValues: false,
-		PatternsDir:       patternsDir,
+		PatternsDir:       dir,
+	}
+	gk, err := grok.New(grokConfig)
+	if err != nil {
+		// the patterns are only needed by grok rules
+		if len(cfg.Grok) > 0 {
+			log.Fatalln("load grok patterns:", dir, "fail:", err)
+		}
+		log.Println("load grok patterns:", dir, "fail:", err)
+		gk, _ = grok.New(&grok.Config{NamedCapturesOnly: true})
+	}
+	ipdb, err := ipsearch.NewReloader(func() (ipsearch.IPLookup, error) {
+		return newIPLookup(cfg.IPDB)
+	}, ipdbFiles(cfg.IPDB)...)
+	if err != nil {
+		log.Fatalln("load ip database fail:", err)
+	}
+	c, err := newCooker(cfg, gk, ipdb)
+	if err != nil {
+		log.Fatalln("parse cook config fail:", err)
+	}
+	if c.ipCache != nil {
+		ipdb.OnReload = c.ipCache.Purge
+	}
+	if cfg.IPDB.ReloadInterval > 0 {
+		go ipdb.Watch(time.Duration(cfg.IPDB.ReloadInterval)*time.Second, nil)
+	}
+	ipdbReloader.Store(ipdb)
+	if c.threat != nil {
+		if cfg.Threat.ReloadInterval > 0 {
+			go c.threat.feeds.Watch(time.Duration(cfg.Threat.ReloadInterval)*time.Second, nil)
+		}
+		threatFeeds.Store(c.threat.feeds)
+	}
+	caches.Store(map[string]*lru.Cache{
+		"ip":            c.ipCache,
+		"ua":            c.uaCache,
+		"rdns":          defaultResolver.positive,
+		"rdns_negative": defaultResolver.negative,
+	})
+	return *c
+}
+
+// the threat feeds of the running cooker, for ReloadThreat
+var threatFeeds atomic.Value
+
+//ReloadThreat read the threat feeds of the running cooker again
+func ReloadThreat() error {
+	f, ok := threatFeeds.Load().(*intel.Feeds)
+	if !ok {
+		return errors.New("no threat feed is configured")
 	}
-	g, _ := grok.New(grokConfig)
-	p, _ := ipsearch.New(ipRegionFile)
+	return f.Reload()
+}
 
-	return Cooker{p, g}
+// the enrichment caches of the running cooker, for CacheStats
+var caches atomic.Value
+
+//CacheStats returns the counters of the enabled enrichment caches of the running cooker
+func CacheStats() map[string]lru.Stats {
+	stats := make(map[string]lru.Stats)
+	m, _ := caches.Load().(map[string]*lru.Cache)
+	for name, c := range m {
+		if c != nil {
+			stats[name] = c.Stats()
+		}
+	}
+	return stats
 }
 
-//Cook return a string be cooked and error
-func (c *Cooker) Cook(msg string) ([]byte, error) {
-	ts0 := time.Now()
-	js, err := simplejson.NewJson([]byte(msg))
+//newCache returns nil when the cache is disabled
+func newCache(cfg g.CacheConfig) *lru.Cache {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	return lru.New(cfg.Size, time.Duration(cfg.TTL)*time.Second)
+}
+
+// the ip database of the running cooker, for ReloadIPDB
+var ipdbReloader atomic.Value
+
+//ReloadIPDB load the ip database files of the running cooker again
+func ReloadIPDB() error {
+	r, ok := ipdbReloader.Load().(*ipsearch.Reloader)
+	if !ok {
+		return errors.New("cooker is not running")
+	}
+	return r.Reload()
+}
+
+//ipdbFiles returns the database files of the backend
+func ipdbFiles(cfg g.IPDBConfig) []string {
+	file := cfg.File
+	if len(file) == 0 && (cfg.Backend == "" || cfg.Backend == "qqzeng") {
+		file = ipRegionFile
+	}
+	files := []string{file}
+	if len(cfg.IPv6File) > 0 {
+		files = append(files, cfg.IPv6File)
+	}
+	return files
+}
+
+//newIPLookup open the configured ip database backend
+func newIPLookup(cfg g.IPDBConfig) (ipsearch.IPLookup, error) {
+	switch cfg.Backend {
+	case "", "qqzeng":
+		p, err := ipsearch.Load(ipdbFiles(cfg)[0])
+		if err != nil {
+			return nil, err
+		}
+		q := &ipsearch.QQZeng{V4: p}
+		if len(cfg.IPv6File) > 0 {
+			v6, err := ipsearch.NewIPv6(cfg.IPv6File)
+			if err != nil {
+				return nil, err
+			}
+			q.V6 = v6
+		}
+		return q, nil
+	case "mmdb":
+		return ipsearch.OpenMMDB(cfg.File, cfg.Language)
+	}
+	return nil, fmt.Errorf("unknown ip database backend %q", cfg.Backend)
+}
+
+//newASNLookup open the configured asn database, none is configured without a file
+func newASNLookup(cfg g.ASNConfig) (ipsearch.ASNLookup, error) {
+	if len(cfg.File) == 0 {
+		return nil, nil
+	}
+	switch cfg.Backend {
+	case "", "csv":
+		return ipsearch.NewASNFile(cfg.File)
+	case "mmdb":
+		return ipsearch.OpenMMDB(cfg.File, "")
+	}
+	return nil, fmt.Errorf("unknown asn database backend %q", cfg.Backend)
+}
+
+//newNetworks load the internal ranges of the networks file, inline cidrs are added over it
+func newNetworks(cfg g.NetworksConfig) (*ipsearch.CIDRTable, error) {
+	t := ipsearch.NewCIDRTable()
+	if len(cfg.File) > 0 {
+		var err error
+		if t, err = ipsearch.NewCIDRFile(cfg.File); err != nil {
+			return nil, err
+		}
+	}
+	for cidr, attrs := range cfg.CIDRs {
+		if err := t.Add(cidr, attrs); err != nil {
+			return nil, fmt.Errorf("network %s: %s", cidr, err.Error())
+		}
+	}
+	return t, nil
+}
+
+//newCooker compile the rules of cfg against the loaded patterns
+func newCooker(cfg *g.CookConfig, gk *grok.Grok, ipdb ipsearch.IPLookup) (*Cooker, error) {
+	rules, err := newGrokRules(gk, cfg.Grok)
 	if err != nil {
 		return nil, err
 	}
-	js.Set("cook_ts0", ts0.UnixNano()/1000)
-	if _, e := js.Get("@timestamp").String(); e != nil {
-		// RFC3339     = "2006-01-02T15:04:05Z07:00"
-		js.Set("@timestamp", ts0.Format(time.RFC3339))
+	processors, err := newProcessors(cfg.Processors)
+	if err != nil {
+		return nil, err
 	}
-
-	docType, err := js.Get("type").String()
+	enrichRules, err := newEnrichRules(cfg.Enrich)
+	if err != nil {
+		return nil, err
+	}
+	networks, err := newNetworks(cfg.Networks)
+	if err != nil {
+		return nil, err
+	}
+	asn, err := newASNLookup(cfg.ASN)
 	if err != nil {
 		return nil, err
 	}
+	threat, err := newThreatMatcher(cfg.Threat)
+	if err != nil {
+		return nil, err
+	}
+	ua, err := newUAParser(cfg.UserAgent.Crawlers)
+	if err != nil {
+		return nil, err
+	}
+	return &Cooker{
+		ipdb:        ipdb,
+		asn:         asn,
+		networks:    networks,
+		grok:        gk,
+		grokRules:   rules,
+		processors:  processors,
+		enrichRules: enrichRules,
+		ipCache:     newCache(cfg.IPCache),
+		uaCache:     newCache(cfg.UACache),
+		ua:          ua,
+		threat:      threat,
+		ecs:         cfg.ECS,
+		legacyIP:    !cfg.IPDB.TypedRecord && (cfg.IPDB.Backend == "" || cfg.IPDB.Backend == "qqzeng"),
+	}, nil
+}
 
-	if ip, e := js.Get(docType).Get("src_ip").String(); e == nil {
-		js.SetPath([]string{docType, "src_ip"}, c.handleIP(ip))
-	} else if num, e := js.Get(docType).Get("src_ip").Int(); e == nil {
-		js.SetPath([]string{docType, "src_ip"}, c.handleIP(num))
+//Cook return a string be cooked and error
+func (c *Cooker) Cook(msg string) ([]byte, error) {
+	e := event.New([]byte(msg))
+	if err := c.CookEvent(e); err != nil {
+		return nil, err
 	}
+	return e.Bytes()
+}
 
-	if ip, e := js.Get(docType).Get("dst_ip").String(); e == nil {
-		js.SetPath([]string{docType, "dst_ip"}, c.handleIP(ip))
-	} else if num, e := js.Get(docType).Get("dst_ip").Int(); e == nil {
-		js.SetPath([]string{docType, "dst_ip"}, c.handleIP(num))
+//CookEvent cook the payload of the event in place. The stages first read it without parsing,
+//it is parsed once by the first one changing it and an event left unchanged is not encoded again.
+//The cook timing is stamped on the event, not written to the payload.
+func (c *Cooker) CookEvent(e *event.Event) error {
+	ts0 := e.Stamp(event.StageCook)
+	if !e.Valid() {
+		return errors.New("invalid json")
+	}
+	if _, err := e.String("@timestamp"); err != nil {
+		// RFC3339     = "2006-01-02T15:04:05Z07:00"
+		if err := e.Set([]string{"@timestamp"}, ts0.Format(time.RFC3339)); err != nil {
+			return err
+		}
 	}
 
-	if ua, e := js.Get(docType).Get("user_agent").String(); e == nil {
-		js.SetPath([]string{docType, "user_agent"}, c.handleUA(ua))
+	docType, err := e.String("type")
+	if err != nil {
+		return err
 	}
 
-	ts1 := time.Now()
-	js.Set("cook_ts1", ts1.UnixNano()/1000)
-	js.Set("cook_latency_us", (ts1.UnixNano()-ts0.UnixNano())/1000)
-	bs, err := js.MarshalJSON()
+	if c.grokApplies(e.Get, docType) {
+		js, err := e.JSON()
+		if err != nil {
+			return err
+		}
+		c.handleGrok(js, docType)
+	}
+	drop, err := c.handleProcessors(e, docType)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if drop {
+		return ErrDropped
+	}
+	// processors may have rewritten the type
+	if docType, err = e.String("type"); err != nil {
+		return err
 	}
 
-	return bs, nil
+	if c.enrichApplies(e.Get, docType) {
+		js, err := e.JSON()
+		if err != nil {
+			return err
+		}
+		c.handleEnrich(js, docType)
+	}
+	if err := c.handleThreat(e, docType); err != nil {
+		return err
+	}
+
+	if c.ecs.Enabled {
+		js, err := e.JSON()
+		if err != nil {
+			return err
+		}
+		created, _ := e.StampOf(event.StageInput)
+		c.handleECS(js, docType, created, time.Now())
+	}
+	return nil
 }
 
+//handleUA parse a user agent, results are cached when the ua cache is enabled
 func (c *Cooker) handleUA(s string) map[string]interface{} {
-	ua := user_agent.New(s)
-	m := make(map[string]interface{})
-	m["raw"] = s
-	if len(s) > 0 {
-		m["browser"], m["browser_version"] = ua.Browser()
-		m["os"] = ua.OS()
-		m["platform"] = ua.Platform()
-		m["engine"], m["engine_version"] = ua.Engine()
-		m["bot"] = ua.Bot()
+	p := c.ua
+	if p == nil {
+		p = defaultUAParser
+	}
+	if c.uaCache == nil {
+		return p.parse(s)
+	}
+	if v, ok := c.uaCache.Get(s); ok {
+		return deepCopy(v).(map[string]interface{})
 	}
+	m := p.parse(s)
+	c.uaCache.Add(s, deepCopy(m))
 	return m
 }
 
-func (c *Cooker) handleIP(ip interface{}) map[string]interface{} {
-	ipInfo := c.ipsearch.Get(ip)
-	m := make(map[string]interface{})
-	m["raw"] = ip
-	m["region"] = ""
-	m["isp"] = ""
-	m["latitude"] = ""
-	m["longtitude"] = ""
-
-	var intIP uint32
-	var ips string
+//parseIP accept dotted ipv4, ipv6 and integer ipv4 addresses
+func parseIP(ip interface{}) (net.IP, error) {
 	switch t := ip.(type) {
 	case string:
-		ips = ip.(string)
-		if len(ips) == 0 {
-			intIP = 0
-		} else {
-			intIP = ipsearch.IpToLong(ip.(string))
+		if parsed := net.ParseIP(strings.TrimSpace(t)); parsed != nil {
+			return parsed, nil
 		}
+		return nil, fmt.Errorf("invalid ip %q", t)
+	case net.IP:
+		return t, nil
 	case int:
-		intIP = uint32(ip.(int))
+		return ipFromInt(int64(t))
+	case int64:
+		return ipFromInt(t)
 	case uint32:
-		intIP = ip.(uint32)
-	default:
-		log.Fatalf("ip type not support %s", t)
+		return ipFromInt(int64(t))
+	}
+	return nil, fmt.Errorf("ip type %T not supported", ip)
+}
+
+func ipFromInt(n int64) (net.IP, error) {
+	if n < 0 || n > math.MaxUint32 {
+		return nil, fmt.Errorf("integer ip %d out of ipv4 range", n)
+	}
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)), nil
+}
+
+//handleIP returns the address forms and the ip database record of ip, results are cached when the ip cache is enabled
+func (c *Cooker) handleIP(ip interface{}) (map[string]interface{}, error) {
+	parsed, err := parseIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if c.ipCache == nil {
+		m = c.lookupIP(parsed)
+	} else {
+		key := string(parsed.To16())
+		if v, ok := c.ipCache.Get(key); ok {
+			m = deepCopy(v).(map[string]interface{})
+		} else {
+			m = c.lookupIP(parsed)
+			c.ipCache.Add(key, deepCopy(m))
+		}
+	}
+	// raw keeps the type of each event's value
+	m["raw"] = ip
+	return m, nil
+}
+
+func (c *Cooker) lookupIP(parsed net.IP) map[string]interface{} {
+	m := make(map[string]interface{})
+	m["dotted"] = parsed.String()
+	if intIP, ok := ipsearch.IPToUint32(parsed); ok {
+		m["version"] = 4
+		m["decimal"] = intIP
+	} else {
+		m["version"] = 6
 	}
-	m["decimal"] = intIP
-	m["dotted"] = ipsearch.LongToIp(intIP)
 
-	if len(ipInfo) > 0 {
-		sl := strings.Split(ipInfo, "|")
-		if len(sl) > 10 && sl[5] != "qqzeng-ip" {
-			m["region"] = sl[3]
-			m["isp"] = sl[5]
-			m["latitude"] = sl[9]
-			m["longtitude"] = sl[10]
+	var rec ipsearch.Record
+	var found bool
+	if c.ipdb != nil {
+		rec, found = c.ipdb.Lookup(parsed)
+	}
+	m["continent"] = rec.Continent
+	m["country"] = rec.Country
+	m["country_code"] = rec.CountryCode
+	m["city"] = rec.City
+	if c.legacyIP {
+		setLegacyIP(m, rec)
+	} else {
+		m["region"] = rec.Region
+		m["isp"] = rec.ISP
+		if found {
+			m["latitude"] = rec.Latitude
+			m["longitude"] = rec.Longitude
+		}
+	}
+	asn := ipsearch.ASN{Number: rec.ASN, Org: rec.ASOrg}
+	if c.asn != nil {
+		if a, ok := c.asn.LookupASN(parsed); ok {
+			asn = a
+		}
+	}
+	if asn.Number > 0 {
+		m["asn"] = map[string]interface{}{"number": asn.Number, "org": asn.Org}
+	}
+
+	// internal ranges aren't in the ip database, their attributes go under network_attrs
+	// so they never overwrite the keys of the record
+	m["network"] = ipsearch.Classify(parsed)
+	if c.networks != nil {
+		if n, ok := c.networks.Lookup(parsed); ok {
+			m["cidr"] = n.Net.String()
+			if len(n.Attrs) > 0 {
+				attrs := make(map[string]interface{}, len(n.Attrs))
+				for k, v := range n.Attrs {
+					attrs[k] = v
+				}
+				m["network_attrs"] = attrs
+			}
 		}
 	}
 	return m
 }
 
+//setLegacyIP set the keys the qqzeng records had before typedRecord, with the same values
+//for the existing indices: strings of the info columns, "" for unknown addresses. Note that
+//latitude holds the longitude column and longtitude the latitude one.
+func setLegacyIP(m map[string]interface{}, rec ipsearch.Record) {
+	m["region"], m["isp"], m["latitude"], m["longtitude"] = "", "", "", ""
+	if cols := strings.Split(rec.Info, "|"); len(cols) > 10 {
+		m["region"] = cols[3]
+		m["isp"] = cols[5]
+		m["latitude"] = cols[9]
+		m["longtitude"] = cols[10]
+	}
+}
+
 func (c *Cooker) handlePerfData(s string) map[string]interface{} {
 	m := make(map[string]interface{})
 	m["raw"] = s
@@ -0,0 +1,318 @@
+package cook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/expr"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/grok"
+	"github.com/chenyoufu/yfstream/pull"
+)
+
+//newTestCooker returns a Cooker without ip database using the in-tree grok patterns
+func newTestCooker(t testing.TB, cfg g.CookConfig) *Cooker {
+	gk, err := grok.New(&grok.Config{NamedCapturesOnly: true, PatternsDir: "../grok/patterns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newCooker(&cfg, gk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func cook(t *testing.T, c *Cooker, msg string) *simplejson.Json {
+	b, err := c.Cook(msg)
+	if err != nil {
+		t.Fatalf("Cook(%q) fail: %s", msg, err.Error())
+	}
+	js, err := simplejson.NewJson(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+func TestCookGrok(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{Grok: []g.GrokRule{
+		{
+			Types:    []string{"nginx"},
+			Field:    "message",
+			Patterns: []string{"%{NGINX_ERROR_LOG}", "%{NGINX_ACCESS_LOG_COMBINED}"},
+			Target:   "nginx",
+		},
+		{
+			Match:    map[string]string{"source": "nagios"},
+			Field:    "message",
+			Patterns: []string{`%{DATA:status} \| %{GREEDYDATA:perf}`},
+			PerfData: []string{"perf"},
+		},
+	}})
+
+	js := cook(t, c, `{"type":"nginx","message":"10.0.0.1 - - [23/Apr/2014:22:58:32 +0200] \"GET /index.php HTTP/1.1\" 404 207 \"-\" \"curl/7.29.0\""}`)
+	if v, _ := js.GetPath("nginx", "remote_addr").String(); v != "10.0.0.1" {
+		t.Errorf("nginx.remote_addr = %q, but we want %q", v, "10.0.0.1")
+	}
+	if v, err := js.GetPath("nginx", "status_code").Int(); err != nil || v != 404 {
+		t.Errorf("nginx.status_code = %v, %v, but we want the int 404", v, err)
+	}
+	if _, ok := js.CheckGet("tags"); ok {
+		t.Errorf("a parsed event should not be tagged")
+	}
+
+	js = cook(t, c, `{"type":"nginx","message":"garbage"}`)
+	if tags, _ := js.Get("tags").StringArray(); len(tags) != 1 || tags[0] != grokParseFailure {
+		t.Errorf("tags = %v, but we want [%s]", tags, grokParseFailure)
+	}
+
+	js = cook(t, c, `{"type":"dns","message":"garbage"}`)
+	if _, ok := js.CheckGet("tags"); ok {
+		t.Errorf("rules of other types should not apply")
+	}
+
+	js = cook(t, c, `{"type":"check","source":"nagios","message":"OK | load1=0.5 load5=1.25"}`)
+	if v, _ := js.GetPath("perf", "load5").Float64(); v != 1.25 {
+		t.Errorf("perf.load5 = %v, but we want 1.25", v)
+	}
+}
+
+func TestGrokRulesInvalid(t *testing.T) {
+	gk, _ := grok.New(&grok.Config{NamedCapturesOnly: true})
+	var tests = [][]g.GrokRule{
+		{{Field: "message"}},
+		{{Field: "message", Patterns: []string{"%{NO_SUCH_PATTERN}"}}},
+	}
+	for _, rules := range tests {
+		if _, err := newGrokRules(gk, rules); err == nil {
+			t.Errorf("newGrokRules(%#v) should fail", rules)
+		}
+	}
+}
+
+func TestCookProcessors(t *testing.T) {
+	var tests = []struct {
+		processors []g.ProcessorConfig
+		msg        string
+		path       string
+		want       string
+	}{
+		{[]g.ProcessorConfig{{Processor: "set", Field: "a.b", Value: "x"}}, `{"type":"t"}`, "a.b", `"x"`},
+		{[]g.ProcessorConfig{{Processor: "default", Field: "a", Value: 1}}, `{"type":"t","a":2}`, "a", `2`},
+		{[]g.ProcessorConfig{{Processor: "default", Field: "a", Value: 1}}, `{"type":"t","a":""}`, "a", `1`},
+		{[]g.ProcessorConfig{{Processor: "rename", Field: "a", Target: "b.c"}}, `{"type":"t","a":1}`, "b", `{"c":1}`},
+		{[]g.ProcessorConfig{{Processor: "rename", Field: "a", Target: "b"}}, `{"type":"t","a":1}`, "a", `null`},
+		{[]g.ProcessorConfig{{Processor: "copy", Field: "a", Target: "b"}}, `{"type":"t","a":{"x":1}}`, "b", `{"x":1}`},
+		{[]g.ProcessorConfig{{Processor: "remove", Fields: []string{"a.x", "b"}}}, `{"type":"t","a":{"x":1,"y":2},"b":3}`, "a", `{"y":2}`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":" 42 "}`, "a", `42`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "float"}}, `{"type":"t","a":"1.5"}`, "a", `1.5`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "string"}}, `{"type":"t","a":7}`, "a", `"7"`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "bool"}}, `{"type":"t","a":"true"}`, "a", `true`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":"x"}`, "tags", `["_convertfailure"]`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":"3.0"}`, "a", `3`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":-2e3}`, "a", `-2000`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":"1.5"}`, "tags", `["_convertfailure"]`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":1.5}`, "tags", `["_convertfailure"]`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":"9223372036854775808"}`, "tags", `["_convertfailure"]`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":1e19}`, "tags", `["_convertfailure"]`},
+		{[]g.ProcessorConfig{{Processor: "convert", Field: "a", To: "int"}}, `{"type":"t","a":"-9223372036854775808"}`, "a", `-9223372036854775808`},
+		{[]g.ProcessorConfig{{Processor: "lowercase", Field: "a"}}, `{"type":"t","a":"GET"}`, "a", `"get"`},
+		{[]g.ProcessorConfig{{Processor: "trim", Fields: []string{"a"}}}, `{"type":"t","a":" x "}`, "a", `"x"`},
+		{[]g.ProcessorConfig{{Processor: "split", Field: "a", Separator: ","}}, `{"type":"t","a":"x,y"}`, "a", `["x","y"]`},
+		{[]g.ProcessorConfig{{Processor: "join", Field: "a", Target: "b", Separator: "-"}}, `{"type":"t","a":["x",1]}`, "b", `"x-1"`},
+		{[]g.ProcessorConfig{{Processor: "set", Types: []string{"other"}, Field: "a", Value: 1}}, `{"type":"t","a":2}`, "a", `2`},
+		{[]g.ProcessorConfig{{Processor: "set", Types: []string{"t"}, Field: "a", Value: 1}}, `{"type":"t","a":2}`, "a", `1`},
+		{[]g.ProcessorConfig{{Processor: "set", If: `a > 1`, Field: "b", Value: 1}}, `{"type":"t","a":2}`, "b", `1`},
+		{[]g.ProcessorConfig{{Processor: "set", If: `a > 1`, Field: "b", Value: 1}}, `{"type":"t","a":1}`, "b", `null`},
+		{[]g.ProcessorConfig{
+			{Processor: "rename", Field: "a", Target: "b"},
+			{Processor: "lowercase", Field: "b"},
+		}, `{"type":"t","a":"X"}`, "b", `"x"`},
+	}
+
+	for _, tt := range tests {
+		c := newTestCooker(t, g.CookConfig{Processors: tt.processors})
+		js := cook(t, c, tt.msg)
+		b, _ := json.Marshal(js.GetPath(splitPath(tt.path)...).Interface())
+		if string(b) != tt.want {
+			t.Errorf("Cook(%s) with %v: %s = %s, but we want %s", tt.msg, tt.processors, tt.path, b, tt.want)
+		}
+	}
+}
+
+func TestCookProcessorValueCopy(t *testing.T) {
+	for _, processor := range []string{"set", "default"} {
+		value := map[string]interface{}{"tags": []interface{}{"a"}}
+		c := newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{
+			{Processor: processor, Field: "labels", Value: value},
+			{Processor: "copy", Field: "owner", Target: "labels.owner"},
+		}})
+		cook(t, c, `{"type":"t","owner":"payments"}`)
+		js := cook(t, c, `{"type":"t"}`)
+		b, _ := json.Marshal(js.Get("labels").Interface())
+		if string(b) != `{"tags":["a"]}` {
+			t.Errorf("%s: labels of the next event = %s, but we want the configured value", processor, b)
+		}
+		if b, _ := json.Marshal(value); string(b) != `{"tags":["a"]}` {
+			t.Errorf("%s: the configured value = %s, but we want it unchanged", processor, b)
+		}
+	}
+}
+
+func TestCookDropIf(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{
+		{Processor: "drop_if", Types: []string{"t"}, Field: "level", Value: "debug"},
+		{Processor: "drop_if", Field: "noise"},
+		{Processor: "drop_if", If: `type == "http" and http.status_code < 400 and cidr(http.client, "10.0.0.0/8")`},
+	}})
+	var tests = []struct {
+		msg  string
+		drop bool
+	}{
+		{`{"type":"t","level":"debug"}`, true},
+		{`{"type":"t","level":"info"}`, false},
+		{`{"type":"u","level":"debug"}`, false},
+		{`{"type":"u","noise":false}`, true},
+		{`{"type":"http","http":{"status_code":200,"client":"10.1.1.1"}}`, true},
+		{`{"type":"http","http":{"status_code":500,"client":"10.1.1.1"}}`, false},
+		{`{"type":"http","http":{"status_code":200,"client":"8.8.8.8"}}`, false},
+	}
+	for _, tt := range tests {
+		_, err := c.Cook(tt.msg)
+		if drop := err == ErrDropped; drop != tt.drop {
+			t.Errorf("Cook(%s) dropped = %v, but we want %v", tt.msg, drop, tt.drop)
+		}
+	}
+}
+
+func TestRegisterProcessor(t *testing.T) {
+	RegisterProcessor("upper", func(cfg g.ProcessorConfig) (Processor, error) {
+		field := splitPath(cfg.Field)
+		return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+			s, _ := js.GetPath(field...).String()
+			js.SetPath(field, strings.ToUpper(s))
+			return false, nil
+		}), nil
+	})
+	c := newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{{Processor: "upper", Field: "a"}}})
+	js := cook(t, c, `{"type":"t","a":"x"}`)
+	if v, _ := js.Get("a").String(); v != "X" {
+		t.Errorf("a = %q, but we want %q", v, "X")
+	}
+}
+
+func TestProcessorsInvalid(t *testing.T) {
+	var tests = [][]g.ProcessorConfig{
+		{{Processor: "nope"}},
+		{{Processor: "set"}},
+		{{Processor: "rename", Field: "a"}},
+		{{Processor: "convert", Field: "a", To: "date"}},
+		{{Processor: "split", Field: "a"}},
+		{{Processor: "remove"}},
+		{{Processor: "drop_if"}},
+		{{Processor: "drop_if", If: "a =="}},
+	}
+	for _, cfgs := range tests {
+		if _, err := newProcessors(cfgs); err == nil {
+			t.Errorf("newProcessors(%v) should fail", cfgs)
+		}
+	}
+}
+
+func TestCookEventUnchanged(t *testing.T) {
+	c := newEnrichCooker(t, nil)
+	c.processors, _ = newProcessors([]g.ProcessorConfig{
+		{Processor: "drop_if", Field: "level", Value: "debug"},
+		{Processor: "set", Types: []string{"dns"}, Field: "seen", Value: true},
+	})
+
+	var tests = []struct {
+		input   string
+		changed bool
+		err     error
+	}{
+		{`{"type":"tcp","@timestamp":"2017-03-01T10:00:00Z","tcp":{"port":80}}`, false, nil},
+		{`{"type":"tcp","@timestamp":"2017-03-01T10:00:00Z","level":"info"}`, false, nil},
+		{`{"type":"tcp","@timestamp":"2017-03-01T10:00:00Z","level":"debug"}`, false, ErrDropped},
+		{`{"type":"tcp"}`, true, nil},
+		{`{"type":"dns","@timestamp":"2017-03-01T10:00:00Z"}`, true, nil},
+		{`{"type":"http","@timestamp":"2017-03-01T10:00:00Z","http":{"src_ip":"210.51.200.123"}}`, true, nil},
+	}
+	for _, tt := range tests {
+		raw := []byte(tt.input)
+		e := event.New(raw)
+		if err := c.CookEvent(e); err != tt.err {
+			t.Errorf("CookEvent(%s) = %v, but we want %v", tt.input, err, tt.err)
+			continue
+		}
+		b, _ := e.Bytes()
+		if changed := &b[0] != &raw[0]; changed != tt.changed {
+			t.Errorf("CookEvent(%s) changed = %v, but we want %v", tt.input, changed, tt.changed)
+		}
+	}
+
+	if err := c.CookEvent(event.New([]byte(`{"type":"tcp","@timestamp":"x"`))); err == nil {
+		t.Errorf("CookEvent of an invalid json should fail")
+	}
+}
+
+// packetbeat events as they come from kafka, routed on their type. No stage changes the tcp one.
+var (
+	benchMsgs = map[string][]byte{
+		"http": []byte(`{"type":"http","guid":"g1","@timestamp":"2017-03-01T10:00:00Z","http":{"src_ip":"210.51.200.123","dst_ip":"10.0.0.1","src_port":51234,"dst_port":80,"method":"GET","path":"/index.html","code":200,"user_agent":"curl/7.29.0"}}`),
+		"tcp":  []byte(`{"type":"tcp","guid":"g1","@timestamp":"2017-03-01T10:00:00Z","tcp":{"port":80,"bytes_in":512,"bytes_out":2048,"responsetime":3}}`),
+	}
+	benchRoute = expr.MustCompile(`type == "http"`)
+)
+
+//BenchmarkPipeline is the way of a kafka message from the source to the outputs: wrapped, cooked,
+//encoded once and routed. The ES bulk encoding is measured by the dump benchmarks.
+func BenchmarkPipeline(b *testing.B) {
+	c := newEnrichCooker(b, nil)
+	for name, msg := range benchMsgs {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e := pull.SemiCooKafkaMsg(&sarama.ConsumerMessage{Topic: "packetbeat", Offset: int64(i), Value: msg})
+				if err := c.CookEvent(e); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := e.Bytes(); err != nil {
+					b.Fatal(err)
+				}
+				benchRoute.Eval(e.Get)
+			}
+		})
+	}
+}
+
+func TestSampleConfigNginx(t *testing.T) {
+	b, err := ioutil.ReadFile("../cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sample struct {
+		Cook g.CookConfig `json:"cook"`
+	}
+	if err := json.Unmarshal(b, &sample); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCooker(t, g.CookConfig{Grok: sample.Cook.Grok, Processors: sample.Cook.Processors})
+
+	line := `10.1.2.3 - - [20/May/2016:10:20:30 +0800] "GET %s HTTP/1.1" 200 612 "-" "curl/7.29.0"`
+	js := cook(t, c, `{"type":"nginx","message":`+strconv.Quote(fmt.Sprintf(line, "/index.html"))+`}`)
+	if v := js.GetPath("nginx", "resp_body_bytes").Interface(); fmt.Sprintf("%T %v", v, v) != "json.Number 612" {
+		t.Errorf("nginx.resp_body_bytes = %#v, but we want the sample convert to give the number 612", v)
+	}
+	if _, err := c.Cook(`{"type":"nginx","message":` + strconv.Quote(fmt.Sprintf(line, "/health")) + `}`); err != ErrDropped {
+		t.Errorf("Cook(/health) = %v, but we want the sample drop_if to drop it", err)
+	}
+}
@@ -0,0 +1,236 @@
+package cook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/g"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// overridden by tests to infer syslog years
+var dateNow = time.Now
+
+//dateFormats are the named layouts of the grok timestamp patterns
+var dateFormats = map[string][]string{
+	// TIMESTAMP_ISO8601, also the es, kafka, zk and mongodb logs; fractions may use a comma
+	"ISO8601": {
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z0700",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+	},
+	"HTTPDATE":           {"02/Jan/2006:15:04:05.999999999 -0700"},
+	"SYSLOGTIMESTAMP":    {"Jan _2 15:04:05.999999999", "Jan 02 15:04:05.999999999"},
+	"DATESTAMP_EVENTLOG": {"20060102150405"},
+	"NGINX_TIMESTAMP":    {"2006/01/02 15:04:05", "2006/01/02T15:04:05"},
+	"FAIR_TIMESTAMP":     {"2006/01/02 15:04:05", "2006/01/02T15:04:05"},
+	"REDIS_TIMESTAMP":    {"_2 Jan 15:04:05.999999999"},
+	"HWTIMESTAMP":        {"Jan _2 2006 15:04:05"},
+}
+
+//strftimeLayouts map strftime directives to go layout elements
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03",
+	'M': "04", 'S': "05", 'f': "999999999", 'b': "Jan", 'B': "January", 'a': "Mon",
+	'A': "Monday", 'p': "PM", 'z': "-0700", 'Z': "MST", 'j': "002", '%': "%",
+}
+
+//strftimeLayout translate a strftime format to a go layout
+func strftimeLayout(format string) (string, error) {
+	var b bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		if i++; i >= len(format) {
+			return "", errors.New("trailing % in " + format)
+		}
+		l, ok := strftimeLayouts[format[i]]
+		if !ok {
+			return "", fmt.Errorf("unknown directive %%%c in %s", format[i], format)
+		}
+		b.WriteString(l)
+	}
+	return b.String(), nil
+}
+
+//dateParser parse one format into a time in the default location
+type dateParser func(s string, loc *time.Location) (time.Time, error)
+
+func layoutParser(layouts []string) dateParser {
+	return func(s string, loc *time.Location) (time.Time, error) {
+		var err error
+		for _, l := range layouts {
+			var t time.Time
+			if t, err = time.ParseInLocation(l, s, loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, err
+	}
+}
+
+//unixParser parse a decimal count of units of unitNs nanoseconds, digits are kept exact
+func unixParser(unitNs int64) dateParser {
+	return func(s string, loc *time.Location) (time.Time, error) {
+		if strings.ContainsAny(s, "eE") {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(0, int64(f*float64(unitNs))).In(loc), nil
+		}
+		neg := strings.HasPrefix(s, "-")
+		ip, fp := strings.TrimPrefix(s, "-"), ""
+		if i := strings.IndexByte(ip, '.'); i >= 0 {
+			ip, fp = ip[:i], ip[i+1:]
+		}
+		n, err := strconv.ParseUint(ip, 10, 63)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(fp) > 9 {
+			fp = fp[:9]
+		}
+		var frac int64
+		if len(fp) > 0 {
+			f, err := strconv.ParseUint(fp+strings.Repeat("0", 9-len(fp)), 10, 63)
+			if err != nil {
+				return time.Time{}, err
+			}
+			frac = int64(f) * unitNs / 1e9
+		}
+		ns := int64(n)*unitNs + frac
+		if neg {
+			ns = -ns
+		}
+		return time.Unix(0, ns).In(loc), nil
+	}
+}
+
+// TAI64 labels start at 2^62, plus the 10 seconds TAI was ahead of UTC in 1970
+const tai64Epoch = 1<<62 + 10
+
+//parseTAI64N parse an optionally @ prefixed hex TAI64N label
+func parseTAI64N(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimPrefix(s, "@")
+	if len(s) != 24 {
+		return time.Time{}, errors.New("tai64n label must be 24 hex digits")
+	}
+	sec, err := strconv.ParseUint(s[:16], 16, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if sec < tai64Epoch {
+		return time.Time{}, errors.New("tai64n label before 1970")
+	}
+	nsec, err := strconv.ParseUint(s[16:], 16, 32)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(sec-tai64Epoch), int64(nsec)).In(loc), nil
+}
+
+//newDateParser returns the parser of a named format, strftime format or go layout
+func newDateParser(format string) (dateParser, error) {
+	switch format {
+	case "UNIX":
+		return unixParser(int64(time.Second)), nil
+	case "UNIX_MS":
+		return unixParser(int64(time.Millisecond)), nil
+	case "UNIX_US":
+		return unixParser(int64(time.Microsecond)), nil
+	case "TAI64N":
+		return parseTAI64N, nil
+	}
+	if layouts, ok := dateFormats[format]; ok {
+		return layoutParser(layouts), nil
+	}
+	if strings.Contains(format, "%") {
+		l, err := strftimeLayout(format)
+		if err != nil {
+			return nil, err
+		}
+		return layoutParser([]string{l}), nil
+	}
+	return layoutParser([]string{format}), nil
+}
+
+//inferYear set the year of yearless timestamps, a date far ahead of now is from last year
+func inferYear(t time.Time) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+	now := dateNow().In(t.Location())
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.Sub(now) > 7*24*time.Hour {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// output layouts of the date processor, named by its to option
+var dateOutputs = map[string]string{
+	"":            time.RFC3339,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+}
+
+//newDateProcessor parse field with the first matching format and write it as RFC3339 to target,
+//in seconds like @timestamp. To RFC3339Nano keeps the fraction of a second.
+func newDateProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Formats) == 0 {
+		return nil, errors.New("formats is required")
+	}
+	layout, ok := dateOutputs[cfg.To]
+	if !ok {
+		return nil, fmt.Errorf("unknown date output %q", cfg.To)
+	}
+	target := []string{"@timestamp"}
+	if len(cfg.Target) > 0 {
+		target = splitPath(cfg.Target)
+	}
+	loc := time.Local
+	if len(cfg.Timezone) > 0 {
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	var parsers []dateParser
+	for _, f := range cfg.Formats {
+		p, err := newDateParser(f)
+		if err != nil {
+			return nil, err
+		}
+		parsers = append(parsers, p)
+	}
+
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		v, ok := lookup(js, field)
+		if !ok || v == nil {
+			return false, nil
+		}
+		s := strings.TrimSpace(fmt.Sprint(v))
+		for _, p := range parsers {
+			if t, err := p(s, loc); err == nil {
+				js.SetPath(target, inferYear(t).Format(layout))
+				return false, nil
+			}
+		}
+		return false, fmt.Errorf("no format matches %q", s)
+	}), nil
+}
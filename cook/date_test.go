@@ -0,0 +1,75 @@
+package cook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestCookDate(t *testing.T) {
+	dateNow = func() time.Time { return time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC) }
+	defer func() { dateNow = time.Now }()
+
+	var tests = []struct {
+		formats  []string
+		timezone string
+		to       string
+		value    string
+		want     string
+	}{
+		{[]string{"HTTPDATE"}, "", "", `"23/Apr/2014:22:58:32 +0200"`, "2014-04-23T22:58:32+02:00"},
+		{[]string{"ISO8601"}, "UTC", "RFC3339Nano", `"2016-03-31 11:23:36,227"`, "2016-03-31T11:23:36.227Z"},
+		{[]string{"ISO8601"}, "UTC", "RFC3339Nano", `"2016-03-31T11:23:36.5+08:00"`, "2016-03-31T11:23:36.5+08:00"},
+		{[]string{"ISO8601"}, "Asia/Shanghai", "", `"2016-03-31 11:23:36"`, "2016-03-31T11:23:36+08:00"},
+		{[]string{"HTTPDATE", "NGINX_TIMESTAMP"}, "UTC", "", `"2016/05/20 10:20:30"`, "2016-05-20T10:20:30Z"},
+		{[]string{"DATESTAMP_EVENTLOG"}, "UTC", "", `"20160520102030"`, "2016-05-20T10:20:30Z"},
+		{[]string{"SYSLOGTIMESTAMP"}, "UTC", "", `"Jan  1 10:00:00"`, "2017-01-01T10:00:00Z"},
+		{[]string{"SYSLOGTIMESTAMP"}, "UTC", "", `"Dec 31 23:59:59"`, "2016-12-31T23:59:59Z"},
+		{[]string{"UNIX"}, "UTC", "", `1463739630`, "2016-05-20T10:20:30Z"},
+		{[]string{"UNIX"}, "UTC", "RFC3339Nano", `"1463739630.25"`, "2016-05-20T10:20:30.25Z"},
+		{[]string{"UNIX_MS"}, "UTC", "RFC3339Nano", `1463739630123`, "2016-05-20T10:20:30.123Z"},
+		{[]string{"UNIX_US"}, "UTC", "RFC3339Nano", `"1463739630000001"`, "2016-05-20T10:20:30.000001Z"},
+		{[]string{"TAI64N"}, "UTC", "", `"@400000005735c4f800000000"`, "2016-05-13T12:13:34Z"},
+		{[]string{"%Y-%m-%d %H:%M:%S"}, "UTC", "", `"2016-05-20 10:20:30"`, "2016-05-20T10:20:30Z"},
+		{[]string{"02.01.2006 15:04"}, "UTC", "", `"20.05.2016 10:20"`, "2016-05-20T10:20:00Z"},
+		// seconds unless the fraction is asked for
+		{[]string{"UNIX_MS"}, "UTC", "", `1463739630123`, "2016-05-20T10:20:30Z"},
+		{[]string{"ISO8601"}, "Asia/Shanghai", "RFC3339", `"2016-03-31 11:23:36.5"`, "2016-03-31T11:23:36+08:00"},
+		{[]string{"UNIX"}, "UTC", "RFC3339Nano", `1463739630`, "2016-05-20T10:20:30Z"},
+	}
+	for _, tt := range tests {
+		c := newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{
+			{Processor: "date", Field: "ts", Formats: tt.formats, Timezone: tt.timezone, To: tt.to},
+		}})
+		js := cook(t, c, `{"type":"t","ts":`+tt.value+`}`)
+		if v, _ := js.Get("@timestamp").String(); v != tt.want {
+			t.Errorf("date %v of %s = %q, but we want %q", tt.formats, tt.value, v, tt.want)
+		}
+	}
+}
+
+func TestCookDateFailure(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{
+		{Processor: "date", Field: "ts", Target: "event.ts", Formats: []string{"ISO8601", "UNIX"}},
+	}})
+	js := cook(t, c, `{"type":"t","ts":"yesterday","@timestamp":"2016-01-01T00:00:00Z"}`)
+	if tags, _ := js.Get("tags").StringArray(); len(tags) != 1 || tags[0] != "_datefailure" {
+		t.Errorf("tags = %v, but we want [_datefailure]", tags)
+	}
+	if v, _ := js.Get("@timestamp").String(); v != "2016-01-01T00:00:00Z" {
+		t.Errorf("@timestamp = %q, but we want it untouched", v)
+	}
+
+	var invalid = []g.ProcessorConfig{
+		{Processor: "date", Field: "ts"},
+		{Processor: "date", Field: "ts", Formats: []string{"%Q"}},
+		{Processor: "date", Field: "ts", Formats: []string{"UNIX"}, Timezone: "Mars/Olympus"},
+		{Processor: "date", Field: "ts", Formats: []string{"UNIX"}, To: "RFC822"},
+	}
+	for _, cfg := range invalid {
+		if _, err := newProcessors([]g.ProcessorConfig{cfg}); err == nil {
+			t.Errorf("newProcessors(%v) should fail", cfg)
+		}
+	}
+}
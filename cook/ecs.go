@@ -0,0 +1,290 @@
+package cook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+)
+
+// kinds of ecs fields
+const (
+	ecsValue    = iota // copied as is
+	ecsInt             // converted to an integer, values that don't convert are skipped
+	ecsEndpoint        // an ip address or host, enriched or not
+	ecsUA              // a user agent string or record
+)
+
+//ecsField copy the value at from, relative to the shape base, to the ecs path to
+type ecsField struct {
+	from []string
+	to   []string
+	kind int
+}
+
+func ecsFields(kind int, pairs ...string) []ecsField {
+	var fs []ecsField
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fs = append(fs, ecsField{splitPath(pairs[i]), splitPath(pairs[i+1]), kind})
+	}
+	return fs
+}
+
+//ecsShape is a known input layout, detected by any of its detect fields
+type ecsShape struct {
+	name   string
+	detect [][]string
+	fields []ecsField
+}
+
+func newECSShape(name string, detect []string, fields ...[]ecsField) ecsShape {
+	s := ecsShape{name: name}
+	for _, d := range detect {
+		s.detect = append(s.detect, splitPath(d))
+	}
+	for _, f := range fields {
+		s.fields = append(s.fields, f...)
+	}
+	return s
+}
+
+//ecsShapes are tried in order, under the event type then at the top level
+var ecsShapes = []ecsShape{
+	newECSShape("packetbeat", []string{"src_ip", "dst_ip"},
+		ecsFields(ecsEndpoint, "src_ip", "source", "dst_ip", "destination"),
+		ecsFields(ecsInt, "src_port", "source.port", "dst_port", "destination.port"),
+		ecsFields(ecsUA, "user_agent", "user_agent"),
+	),
+	newECSShape("nginx", []string{"remote_addr", "errmsg"},
+		ecsFields(ecsEndpoint, "remote_addr", "source"),
+		ecsFields(ecsValue, "remote_user", "user.name", "method", "http.request.method", "uri", "url.original",
+			"referrer", "http.request.referrer", "severity", "log.level", "errmsg", "error.message"),
+		ecsFields(ecsInt, "status_code", "http.response.status_code", "resp_body_bytes", "http.response.body.bytes",
+			"pid", "process.pid", "tid", "process.thread.id"),
+		ecsFields(ecsUA, "user_agent", "user_agent"),
+	),
+	newECSShape("haproxy", []string{"frontend_name"},
+		ecsFields(ecsEndpoint, "client_ip", "source"),
+		ecsFields(ecsInt, "client_port", "source.port", "http_status_code", "http.response.status_code",
+			"bytes_read", "http.response.body.bytes", "pid", "process.pid"),
+		ecsFields(ecsValue, "http_verb", "http.request.method", "http_request", "url.original", "http_host", "url.domain",
+			"frontend_name", "haproxy.frontend_name", "backend_name", "haproxy.backend_name", "server_name", "haproxy.server_name",
+			"termination_state", "haproxy.termination_state", "syslog_server", "host.hostname", "program", "process.name"),
+	),
+	newECSShape("apache", []string{"clientip"},
+		ecsFields(ecsEndpoint, "clientip", "source"),
+		ecsFields(ecsValue, "auth", "user.name", "verb", "http.request.method", "request", "url.original",
+			"httpversion", "http.version", "referrer", "http.request.referrer"),
+		ecsFields(ecsInt, "response", "http.response.status_code", "bytes", "http.response.body.bytes"),
+		ecsFields(ecsUA, "agent", "user_agent"),
+	),
+	newECSShape("syslog", []string{"logsource"},
+		ecsFields(ecsValue, "logsource", "host.hostname", "program", "process.name", "message", "message"),
+		ecsFields(ecsInt, "pid", "process.pid"),
+	),
+}
+
+//handleECS add the common schema fields of the event, the legacy fields they come from are removed unless keepLegacy.
+//created is when the event was received and ingested when it was cooked.
+func (c *Cooker) handleECS(js *simplejson.Json, docType string, created, ingested time.Time) {
+	type mapped struct {
+		to []string
+		v  interface{}
+	}
+	var out []mapped
+	var from [][]string
+	shape, base := detectShape(js, docType)
+	if shape != nil {
+		for _, f := range shape.fields {
+			path := append(append([]string{}, base...), f.from...)
+			v, ok := lookup(js, path)
+			if !ok || v == nil {
+				continue
+			}
+			if nv, ok := ecsConvert(v, f.kind); ok {
+				out = append(out, mapped{f.to, nv})
+				from = append(from, path)
+			}
+		}
+	}
+
+	event := map[string]interface{}{"dataset": docType}
+	if shape != nil {
+		event["module"] = shape.name
+	}
+	event["created"] = created.UTC().Format(time.RFC3339Nano)
+	event["ingested"] = ingested.UTC().Format(time.RFC3339Nano)
+	out = append(out, mapped{[]string{"event"}, event})
+
+	// legacy fields go first, an ecs path may be the same as its legacy one
+	if !c.ecs.KeepLegacy {
+		for _, path := range from {
+			remove(js, path)
+		}
+		if len(base) > 0 {
+			if m, err := js.Get(base[0]).Map(); err == nil && len(m) == 0 {
+				js.Del(base[0])
+			}
+		}
+	}
+	for _, m := range out {
+		mergePath(js, m.to, m.v)
+	}
+}
+
+//detectShape returns the first shape found under the event type, or at the top level
+func detectShape(js *simplejson.Json, docType string) (*ecsShape, []string) {
+	for _, base := range [][]string{{docType}, nil} {
+		if len(base) > 0 {
+			if _, err := js.Get(docType).Map(); err != nil {
+				continue
+			}
+		}
+		for i := range ecsShapes {
+			for _, d := range ecsShapes[i].detect {
+				if _, ok := lookup(js, append(append([]string{}, base...), d...)); ok {
+					return &ecsShapes[i], base
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+//mergePath set v at path, maps are merged into an existing map
+func mergePath(js *simplejson.Json, path []string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		js.SetPath(path, v)
+		return
+	}
+	cur, err := js.GetPath(path...).Map()
+	if err != nil {
+		js.SetPath(path, m)
+		return
+	}
+	for k, e := range m {
+		cur[k] = e
+	}
+}
+
+//ecsConvert returns the ecs form of v
+func ecsConvert(v interface{}, kind int) (interface{}, bool) {
+	switch kind {
+	case ecsInt:
+		n, err := convert(v, "int")
+		return n, err == nil
+	case ecsEndpoint:
+		return ecsEndpointOf(v)
+	case ecsUA:
+		return ecsUserAgent(v)
+	}
+	if s, ok := v.(string); ok && (s == "" || s == "-") {
+		return nil, false
+	}
+	return v, true
+}
+
+//ecsEndpointOf convert an ip, a host or a handleIP record
+func ecsEndpointOf(v interface{}) (map[string]interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		s := fmt.Sprint(v)
+		if len(s) == 0 || s == "-" {
+			return nil, false
+		}
+		if ip, err := parseIP(v); err == nil {
+			return map[string]interface{}{"ip": ip.String(), "address": s}, true
+		}
+		return map[string]interface{}{"domain": s, "address": s}, true
+	}
+	ip, ok := m["dotted"].(string)
+	if !ok {
+		return nil, false
+	}
+	e := map[string]interface{}{"ip": ip, "address": fmt.Sprint(m["raw"])}
+	geo := make(map[string]interface{})
+	for from, to := range map[string]string{
+		"continent":    "continent_name",
+		"country":      "country_name",
+		"country_code": "country_iso_code",
+		"region":       "region_name",
+		"city":         "city_name",
+	} {
+		if s, ok := m[from].(string); ok && len(strings.TrimSpace(s)) > 0 {
+			geo[to] = s
+		}
+	}
+	if lat, ok := m["latitude"].(float64); ok {
+		geo["location"] = map[string]interface{}{"lat": lat, "lon": m["longitude"]}
+	} else if lon, err := strconv.ParseFloat(fmt.Sprint(m["latitude"]), 64); err == nil {
+		// a legacy record, its latitude and longtitude keys hold the columns the other way round
+		if lat, err := strconv.ParseFloat(fmt.Sprint(m["longtitude"]), 64); err == nil {
+			geo["location"] = map[string]interface{}{"lat": lat, "lon": lon}
+		}
+	}
+	if len(geo) > 0 {
+		e["geo"] = geo
+	}
+	if asn, ok := m["asn"].(map[string]interface{}); ok {
+		as := map[string]interface{}{"number": asn["number"]}
+		if org, ok := asn["org"].(string); ok && len(org) > 0 {
+			as["organization"] = map[string]interface{}{"name": org}
+		}
+		e["as"] = as
+	}
+	for _, k := range []string{"isp", "network", "cidr"} {
+		if s, ok := m[k].(string); ok && len(s) > 0 {
+			e[k] = s
+		}
+	}
+	if s, ok := m["hostname"].(string); ok && len(s) > 0 {
+		e["domain"] = s
+	}
+	if attrs, ok := m["network_attrs"].(map[string]interface{}); ok && len(attrs) > 0 {
+		e["labels"] = attrs
+	}
+	return e, true
+}
+
+//ecsUserAgent convert a user agent string or a handleUA record
+func ecsUserAgent(v interface{}) (map[string]interface{}, bool) {
+	switch t := v.(type) {
+	case string:
+		if len(t) == 0 || t == "-" {
+			return nil, false
+		}
+		return map[string]interface{}{"original": t}, true
+	case map[string]interface{}:
+		if raw, _ := t["raw"].(string); len(raw) == 0 || raw == "-" {
+			return nil, false
+		}
+		ua := map[string]interface{}{"original": t["raw"]}
+		name, _ := t["browser"].(string)
+		if crawler, _ := t["crawler"].(string); len(crawler) > 0 {
+			name = crawler
+		}
+		if len(name) > 0 {
+			ua["name"] = name
+		}
+		if s, _ := t["browser_version"].(string); len(s) > 0 {
+			ua["version"] = s
+		}
+		os := make(map[string]interface{})
+		for from, to := range map[string]string{"os_name": "name", "os_version": "version", "os": "full"} {
+			if s, _ := t[from].(string); len(s) > 0 {
+				os[to] = s
+			}
+		}
+		if len(os) > 0 {
+			ua["os"] = os
+		}
+		if s, _ := t["device"].(string); len(s) > 0 {
+			ua["device"] = map[string]interface{}{"name": s}
+		}
+		return ua, true
+	}
+	return nil, false
+}
@@ -0,0 +1,131 @@
+package cook
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestCookECS(t *testing.T) {
+	c := newEnrichCooker(t, nil)
+
+	var tests = []struct {
+		input      string
+		keepLegacy bool
+		want       map[string]string
+		absent     []string
+	}{
+		{
+			`{"type":"http","http":{"src_ip":"210.51.200.123","src_port":1234,"dst_ip":3526609019,"user_agent":"curl/7.29.0"}}`, false,
+			map[string]string{
+				"source.ip":              "210.51.200.123",
+				"source.port":            "1234",
+				"source.isp":             "联通",
+				"source.network":         "public",
+				"destination.ip":         "210.51.200.123",
+				"destination.address":    "3526609019",
+				"user_agent.original":    "curl/7.29.0",
+				"user_agent.device.name": "unknown",
+				"event.dataset":          "http",
+				"event.module":           "packetbeat",
+				"type":                   "http",
+			},
+			[]string{"http", "cook_ts0", "cook"},
+		},
+		{
+			`{"type":"http","http":{"src_ip":"210.51.200.123","user_agent":"curl/7.29.0"}}`, true,
+			map[string]string{
+				"source.ip":           "210.51.200.123",
+				"http.src_ip.dotted":  "210.51.200.123",
+				"http.user_agent.raw": "curl/7.29.0",
+				"user_agent.original": "curl/7.29.0",
+			},
+			[]string{"destination"},
+		},
+		{
+			`{"type":"nginx","nginx":{"remote_addr":"10.1.2.3","remote_user":"-","method":"GET","uri":"/a?b=1","status_code":"404","resp_body_bytes":"12","referrer":"-","user_agent":"-"}}`, false,
+			map[string]string{
+				"source.ip":                 "10.1.2.3",
+				"http.request.method":       "GET",
+				"url.original":              "/a?b=1",
+				"http.response.status_code": "404",
+				"http.response.body.bytes":  "12",
+				"event.module":              "nginx",
+			},
+			[]string{"nginx.method", "user.name", "http.request.referrer", "user_agent"},
+		},
+		{
+			`{"type":"lb","client_ip":"10.0.0.1","client_port":"5000","frontend_name":"fe","http_verb":"POST","bytes_read":"x"}`, false,
+			map[string]string{
+				"source.ip":             "10.0.0.1",
+				"source.port":           "5000",
+				"haproxy.frontend_name": "fe",
+				"http.request.method":   "POST",
+				"bytes_read":            "x",
+				"event.module":          "haproxy",
+			},
+			[]string{"client_ip", "frontend_name", "http.response.body.bytes"},
+		},
+		{
+			`{"type":"syslog","logsource":"web1","program":"sshd","pid":"42","message":"hi"}`, false,
+			map[string]string{
+				"host.hostname": "web1",
+				"process.name":  "sshd",
+				"process.pid":   "42",
+				"message":       "hi",
+			},
+			[]string{"logsource", "pid"},
+		},
+		{
+			`{"type":"x","a":1}`, false,
+			map[string]string{"a": "1", "event.dataset": "x"},
+			[]string{"event.module", "source"},
+		},
+	}
+	for _, tt := range tests {
+		c.ecs = g.ECSConfig{Enabled: true, KeepLegacy: tt.keepLegacy}
+		js := cook(t, c, tt.input)
+		for path, want := range tt.want {
+			v, ok := lookup(js, splitPath(path))
+			if got := fmt.Sprint(v); !ok || got != want {
+				t.Errorf("Cook(%s) %s = %v, but we want %s", tt.input, path, v, want)
+			}
+		}
+		for _, path := range tt.absent {
+			if v, ok := lookup(js, splitPath(path)); ok {
+				t.Errorf("Cook(%s) %s = %v, but we want none", tt.input, path, v)
+			}
+		}
+	}
+}
+
+func TestECSEndpoint(t *testing.T) {
+	rec := map[string]interface{}{
+		"raw": "1.2.3.4", "dotted": "1.2.3.4", "country": "中国", "city": "",
+		"latitude": 39.9, "longitude": 116.4, "asn": map[string]interface{}{"number": 4837, "org": "CHINA UNICOM"},
+		"network": "public", "network_attrs": map[string]interface{}{"site": "dc1"},
+	}
+	e, ok := ecsEndpointOf(rec)
+	if !ok {
+		t.Fatal("ecsEndpointOf(record) fail")
+	}
+	want := "map[address:1.2.3.4 as:map[number:4837 organization:map[name:CHINA UNICOM]] " +
+		"geo:map[country_name:中国 location:map[lat:39.9 lon:116.4]] ip:1.2.3.4 labels:map[site:dc1] network:public]"
+	if got := fmt.Sprint(e); got != want {
+		t.Errorf("ecsEndpointOf(record) = %s, but we want %s", got, want)
+	}
+	legacy := map[string]interface{}{
+		"raw": "1.2.3.4", "dotted": "1.2.3.4", "region": " ", "isp": "联通", "latitude": "116.4", "longtitude": "39.9",
+	}
+	want = "map[address:1.2.3.4 geo:map[location:map[lat:39.9 lon:116.4]] ip:1.2.3.4 isp:联通]"
+	if e, _ := ecsEndpointOf(legacy); fmt.Sprint(e) != want {
+		t.Errorf("ecsEndpointOf(legacy record) = %v, but we want %s", e, want)
+	}
+	if e, _ := ecsEndpointOf("www.example.com"); fmt.Sprint(e) != "map[address:www.example.com domain:www.example.com]" {
+		t.Errorf("ecsEndpointOf(host) = %v, but we want a domain", e)
+	}
+	if _, ok := ecsEndpointOf("-"); ok {
+		t.Errorf("ecsEndpointOf(-) = ok, but we want none")
+	}
+}
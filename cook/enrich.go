@@ -0,0 +1,237 @@
+package cook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/expr"
+	"github.com/chenyoufu/yfstream/g"
+	"strings"
+)
+
+//typeElement in an enrich path is replaced by the event type
+const typeElement = "$type"
+
+//legacyEnrichRules are used when the cook config has no enrich section, they match the packetbeat layout
+var legacyEnrichRules = []g.EnrichRule{
+	{Fields: []string{"$type.src_ip", "$type.dst_ip"}, Enrichers: []string{"geo", "isp"}},
+	{Fields: []string{"$type.user_agent"}, Enrichers: []string{"ua"}},
+}
+
+//geoKeys are the handleIP fields of the geo enricher
+var geoKeys = []string{"continent", "country", "country_code", "region", "city", "latitude", "longitude", "longtitude"}
+
+//enrichRule is a g.EnrichRule with its paths split and enrichers resolved
+type enrichRule struct {
+	types  map[string]bool
+	fields [][]string
+	target []string
+	geo    bool
+	isp    bool
+	asn    bool
+	ua     bool
+	rdns   bool
+}
+
+func newEnrichRules(rules []g.EnrichRule) ([]*enrichRule, error) {
+	if rules == nil {
+		rules = legacyEnrichRules
+	}
+	var rs []*enrichRule
+	for i, rule := range rules {
+		if len(rule.Fields) == 0 || len(rule.Enrichers) == 0 {
+			return nil, fmt.Errorf("enrich rule %d needs fields and enrichers", i)
+		}
+		r := &enrichRule{types: make(map[string]bool), target: splitPath(rule.Target)}
+		for _, t := range rule.Types {
+			r.types[t] = true
+		}
+		for _, f := range rule.Fields {
+			r.fields = append(r.fields, splitPath(f))
+		}
+		if len(r.target) > 0 && (len(r.fields) > 1 || strings.Contains(rule.Fields[0], "[]")) {
+			return nil, fmt.Errorf("enrich rule %d: a target needs exactly one field without arrays", i)
+		}
+		for _, e := range rule.Enrichers {
+			switch e {
+			case "geo":
+				r.geo = true
+			case "isp":
+				r.isp = true
+			case "asn":
+				r.asn = true
+			case "ua":
+				r.ua = true
+			case "rdns":
+				r.rdns = true
+			default:
+				return nil, fmt.Errorf("enrich rule %d: unknown enricher %q", i, e)
+			}
+		}
+		if r.ua && (r.geo || r.isp || r.asn || r.rdns) {
+			return nil, fmt.Errorf("enrich rule %d: ua can't be mixed with ip enrichers", i)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+//rewrite replace every value at path with fn(value), elements ending in [] fan out over arrays
+func rewrite(cur interface{}, path []string, fn func(interface{}) (interface{}, bool)) {
+	m, ok := cur.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+	k := path[0]
+	fanOut := strings.HasSuffix(k, "[]")
+	if fanOut {
+		k = k[:len(k)-2]
+	}
+	v, ok := m[k]
+	if !ok {
+		return
+	}
+	if !fanOut {
+		if len(path) > 1 {
+			rewrite(v, path[1:], fn)
+		} else if nv, ok := fn(v); ok {
+			m[k] = nv
+		}
+		return
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		return
+	}
+	for i, e := range l {
+		if len(path) > 1 {
+			rewrite(e, path[1:], fn)
+		} else if nv, ok := fn(e); ok {
+			l[i] = nv
+		}
+	}
+}
+
+//visit call fn with the values at path in the event read by get, [] elements fan out over lists
+func visit(get expr.Getter, path []string, fn func(interface{})) {
+	i := 0
+	for i < len(path) && !strings.HasSuffix(path[i], "[]") {
+		i++
+	}
+	if i == len(path) {
+		if v, ok := get(path); ok {
+			fn(v)
+		}
+		return
+	}
+	head := append(append([]string{}, path[:i]...), strings.TrimSuffix(path[i], "[]"))
+	v, ok := get(head)
+	if !ok {
+		return
+	}
+	rewrite(map[string]interface{}{"v": v}, append([]string{"v[]"}, path[i+1:]...), func(v interface{}) (interface{}, bool) {
+		fn(v)
+		return nil, false
+	})
+}
+
+//withType substitute the event type in path
+func withType(path []string, docType string) []string {
+	p := make([]string, len(path))
+	for i, e := range path {
+		if e == typeElement {
+			e = docType
+		}
+		p[i] = e
+	}
+	return p
+}
+
+//enrichApplies reports whether a rule has a field to enrich in the event read by get
+func (c *Cooker) enrichApplies(get expr.Getter, docType string) bool {
+	found := false
+	for _, r := range c.enrichRules {
+		if len(r.types) > 0 && !r.types[docType] {
+			continue
+		}
+		for _, f := range r.fields {
+			visit(get, withType(f, docType), func(interface{}) { found = true })
+			if found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//handleEnrich run the enrich rules, missing fields and values already enriched are skipped
+func (c *Cooker) handleEnrich(js *simplejson.Json, docType string) {
+	root := js.Interface()
+	for _, r := range c.enrichRules {
+		if len(r.types) > 0 && !r.types[docType] {
+			continue
+		}
+		fn := func(v interface{}) (interface{}, bool) {
+			m := c.enrich(r, v)
+			return m, m != nil
+		}
+		if len(r.target) > 0 {
+			if v, ok := lookup(js, withType(r.fields[0], docType)); ok {
+				if m := c.enrich(r, v); m != nil {
+					js.SetPath(withType(r.target, docType), m)
+				}
+			}
+			continue
+		}
+		for _, f := range r.fields {
+			rewrite(root, withType(f, docType), fn)
+		}
+	}
+}
+
+//enrich returns the enrichment of one value, or nil when the value can't be enriched
+func (c *Cooker) enrich(r *enrichRule, v interface{}) map[string]interface{} {
+	if r.ua {
+		s, ok := v.(string)
+		if !ok {
+			return nil
+		}
+		return c.handleUA(s)
+	}
+
+	var ip interface{}
+	switch t := v.(type) {
+	case string:
+		ip = t
+	case json.Number:
+		n, err := t.Int64()
+		if err != nil {
+			return nil
+		}
+		ip = int(n)
+	case float64:
+		ip = int(t)
+	default:
+		return nil
+	}
+	m, err := c.handleIP(ip)
+	if err != nil {
+		return nil
+	}
+	if !r.geo {
+		for _, k := range geoKeys {
+			delete(m, k)
+		}
+	}
+	if !r.isp {
+		delete(m, "isp")
+	}
+	// the isp enricher always carried the asn
+	if !r.isp && !r.asn {
+		delete(m, "asn")
+	}
+	if r.rdns {
+		m["hostname"] = reverseDNS(m["dotted"].(string))
+	}
+	return m
+}
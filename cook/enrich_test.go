@@ -0,0 +1,296 @@
+package cook
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/ipsearch"
+)
+
+//newEnrichCooker returns a test Cooker with the in-tree ip database
+func newEnrichCooker(t testing.TB, rules []g.EnrichRule) *Cooker {
+	c := newTestCooker(t, g.CookConfig{Enrich: rules})
+	p, err := ipsearch.New("../ipsearch/regionIp.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ipdb = &ipsearch.QQZeng{V4: p}
+	return c
+}
+
+func TestCookEnrichLegacy(t *testing.T) {
+	c := newEnrichCooker(t, nil)
+	js := cook(t, c, `{"type":"http","http":{"src_ip":"210.51.200.123","dst_ip":3526609019,"user_agent":"curl/7.29.0"}}`)
+
+	if v, _ := js.GetPath("http", "src_ip", "isp").String(); v != "联通" {
+		t.Errorf("http.src_ip.isp = %q, but we want %q", v, "联通")
+	}
+	if v, _ := js.GetPath("http", "dst_ip", "dotted").String(); v != "210.51.200.123" {
+		t.Errorf("http.dst_ip.dotted = %q, but we want %q", v, "210.51.200.123")
+	}
+	if v, _ := js.GetPath("http", "user_agent", "raw").String(); v != "curl/7.29.0" {
+		t.Errorf("http.user_agent.raw = %q, but we want %q", v, "curl/7.29.0")
+	}
+}
+
+func TestCookEnrichRules(t *testing.T) {
+	c := newEnrichCooker(t, []g.EnrichRule{
+		{Fields: []string{"nginx.clientip", "fw.hops[].ip", "fw.src_xlated_ip"}, Enrichers: []string{"isp"}},
+		{Types: []string{"nginx"}, Fields: []string{"agent"}, Target: "ua", Enrichers: []string{"ua"}},
+	})
+
+	js := cook(t, c, `{"type":"nginx","nginx":{"clientip":"210.51.200.123"},"agent":"curl/7.29.0"}`)
+	if v, _ := js.GetPath("nginx", "clientip", "isp").String(); v != "联通" {
+		t.Errorf("nginx.clientip.isp = %q, but we want %q", v, "联通")
+	}
+	if _, ok := js.GetPath("nginx", "clientip").CheckGet("region"); ok {
+		t.Errorf("nginx.clientip.region should only be set by the geo enricher")
+	}
+	if v, _ := js.GetPath("ua", "raw").String(); v != "curl/7.29.0" {
+		t.Errorf("ua.raw = %q, but we want %q", v, "curl/7.29.0")
+	}
+	if v, _ := js.Get("agent").String(); v != "curl/7.29.0" {
+		t.Errorf("agent = %q, but we want it untouched", v)
+	}
+
+	js = cook(t, c, `{"type":"fw","fw":{"hops":[{"ip":"210.51.200.123"},{"ip":"10.0.0.1"},{"name":"x"}]},"agent":"curl"}`)
+	hops, _ := js.GetPath("fw", "hops").Array()
+	if len(hops) != 3 {
+		t.Fatalf("fw.hops = %v, but we want 3 hops", hops)
+	}
+	if v, _ := js.GetPath("fw", "hops").GetIndex(0).GetPath("ip", "isp").String(); v != "联通" {
+		t.Errorf("fw.hops[0].ip.isp = %q, but we want %q", v, "联通")
+	}
+	if v, _ := js.GetPath("fw", "hops").GetIndex(1).GetPath("ip", "dotted").String(); v != "10.0.0.1" {
+		t.Errorf("fw.hops[1].ip.dotted = %q, but we want %q", v, "10.0.0.1")
+	}
+	if _, ok := js.CheckGet("ua"); ok {
+		t.Errorf("the ua rule should not apply to fw events")
+	}
+	if _, ok := js.GetPath("fw").CheckGet("src_xlated_ip"); ok {
+		t.Errorf("missing fields should not be created")
+	}
+}
+
+func TestEnrichRulesInvalid(t *testing.T) {
+	var tests = [][]g.EnrichRule{
+		{{Fields: []string{"ip"}}},
+		{{Enrichers: []string{"geo"}}},
+		{{Fields: []string{"ip"}, Enrichers: []string{"weather"}}},
+		{{Fields: []string{"ip"}, Enrichers: []string{"ua", "geo"}}},
+		{{Fields: []string{"a", "b"}, Target: "c", Enrichers: []string{"geo"}}},
+		{{Fields: []string{"a[].ip"}, Target: "c", Enrichers: []string{"geo"}}},
+	}
+	for _, rules := range tests {
+		if _, err := newEnrichRules(rules); err == nil {
+			t.Errorf("newEnrichRules(%v) should fail", rules)
+		}
+	}
+}
+
+func TestHandleIP(t *testing.T) {
+	c := newEnrichCooker(t, nil)
+	v6, err := ipsearch.LoadIPv6(strings.NewReader("2001:db8::,2001:db8::ffff,亚洲|中国|北京| |北京|联通|110000|China|CN|116.4|39.9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ipdb.(*ipsearch.QQZeng).V6 = v6
+
+	var tests = []struct {
+		input   interface{}
+		dotted  string
+		version int
+		isp     string
+	}{
+		{"210.51.200.123", "210.51.200.123", 4, "联通"},
+		{3526609019, "210.51.200.123", 4, "联通"},
+		{"::ffff:210.51.200.123", "210.51.200.123", 4, "联通"},
+		{"2001:db8::1", "2001:db8::1", 6, "联通"},
+		{"2001:0db8:0000::0002", "2001:db8::2", 6, "联通"},
+		{"fe80::1", "fe80::1", 6, ""},
+	}
+	for _, tt := range tests {
+		m, err := c.handleIP(tt.input)
+		if err != nil {
+			t.Errorf("handleIP(%v) fail: %s", tt.input, err.Error())
+			continue
+		}
+		if m["dotted"] != tt.dotted || m["version"] != tt.version || m["isp"] != tt.isp {
+			t.Errorf("handleIP(%v) = %v, but we want dotted %s, version %d, isp %q", tt.input, m, tt.dotted, tt.version, tt.isp)
+		}
+	}
+
+	for _, input := range []interface{}{"", "1.2.3", "nope", -1, int64(1) << 40, true, 1.5} {
+		if _, err := c.handleIP(input); err == nil {
+			t.Errorf("handleIP(%v) should fail", input)
+		}
+	}
+
+	js := cook(t, c, `{"type":"http","http":{"src_ip":"bogus","dst_ip":"2001:db8::1"}}`)
+	if v, _ := js.GetPath("http", "src_ip").String(); v != "bogus" {
+		t.Errorf("http.src_ip = %v, but we want invalid ips untouched", v)
+	}
+	if v, _ := js.GetPath("http", "dst_ip", "dotted").String(); v != "2001:db8::1" {
+		t.Errorf("http.dst_ip.dotted = %v, but we want 2001:db8::1", v)
+	}
+}
+
+//fakeLookup knows a single address
+type fakeLookup struct {
+	ip  string
+	rec ipsearch.Record
+}
+
+func (f fakeLookup) Lookup(ip net.IP) (ipsearch.Record, bool) {
+	if ip.String() != f.ip {
+		return ipsearch.Record{}, false
+	}
+	return f.rec, true
+}
+
+func TestHandleIPRecord(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{IPDB: g.IPDBConfig{TypedRecord: true}})
+	c.ipdb = fakeLookup{"8.8.8.8", ipsearch.Record{
+		Continent: "North America", Country: "United States", CountryCode: "US",
+		City: "Mountain View", ISP: "Google", ASN: 15169, Latitude: 37.4, Longitude: -122.1,
+	}}
+
+	m, _ := c.handleIP("8.8.8.8")
+	want := map[string]interface{}{
+		"country_code": "US", "city": "Mountain View", "isp": "Google",
+		"latitude": 37.4, "longitude": -122.1, "region": "",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("handleIP(8.8.8.8)[%s] = %v, but we want %v", k, m[k], v)
+		}
+	}
+	if asn, _ := m["asn"].(map[string]interface{}); asn["number"] != uint32(15169) {
+		t.Errorf("handleIP(8.8.8.8)[asn] = %v, but we want number 15169", m["asn"])
+	}
+
+	m, _ = c.handleIP("1.1.1.1")
+	if _, ok := m["latitude"]; ok || m["country"] != "" {
+		t.Errorf("handleIP(1.1.1.1) = %v, but we want an empty location", m)
+	}
+	if _, ok := m["longtitude"]; ok {
+		t.Errorf("handleIP(1.1.1.1) = %v, but we want no legacy key", m)
+	}
+}
+
+func TestHandleIPLegacy(t *testing.T) {
+	c := newEnrichCooker(t, nil)
+	var tests = []struct {
+		ip   string
+		want map[string]interface{}
+	}{
+		// the keys and string values of the qqzeng records before the typed ones
+		{"210.51.200.123", map[string]interface{}{
+			"region": " ", "isp": "联通", "latitude": "112.896866", "longtitude": "30.421215", "city": "潜江",
+		}},
+		{"0.0.0.1", map[string]interface{}{"region": "", "isp": "", "latitude": "", "longtitude": ""}},
+	}
+	for _, tt := range tests {
+		m, _ := c.handleIP(tt.ip)
+		for k, v := range tt.want {
+			if m[k] != v {
+				t.Errorf("handleIP(%s)[%s] = %#v, but we want %#v", tt.ip, k, m[k], v)
+			}
+		}
+		if _, ok := m["longitude"]; ok {
+			t.Errorf("handleIP(%s) = %v, but we want no typed longitude", tt.ip, m)
+		}
+	}
+}
+
+func TestHandleIPNetworks(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{Networks: g.NetworksConfig{CIDRs: map[string]map[string]string{
+		"10.0.0.0/8":    {"site": "hz", "region": "浙江"},
+		"10.1.2.0/24":   {"site": "hz", "vlan": "102", "owner": "payments"},
+		"fd00:1::/32":   {"site": "sh"},
+		"100.64.0.0/10": {"isp": "carrier"},
+	}}})
+
+	var tests = []struct {
+		input   string
+		network string
+		want    map[string]interface{}
+		attrs   string
+	}{
+		{"10.1.2.3", "private", map[string]interface{}{"cidr": "10.1.2.0/24", "region": ""}, "map[owner:payments site:hz vlan:102]"},
+		{"10.9.9.9", "private", map[string]interface{}{"cidr": "10.0.0.0/8", "region": ""}, "map[region:浙江 site:hz]"},
+		{"fd00:1::5", "private", nil, "map[site:sh]"},
+		{"100.64.0.1", "cgnat", map[string]interface{}{"isp": ""}, "map[isp:carrier]"},
+		{"127.0.0.1", "loopback", map[string]interface{}{"cidr": nil}, "<nil>"},
+		{"8.8.8.8", "public", map[string]interface{}{"cidr": nil}, "<nil>"},
+	}
+	for _, tt := range tests {
+		m, err := c.handleIP(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m["network"] != tt.network {
+			t.Errorf("handleIP(%s)[network] = %v, but we want %v", tt.input, m["network"], tt.network)
+		}
+		for k, v := range tt.want {
+			if m[k] != v {
+				t.Errorf("handleIP(%s)[%s] = %v, but we want %v", tt.input, k, m[k], v)
+			}
+		}
+		if attrs := fmt.Sprint(m["network_attrs"]); attrs != tt.attrs {
+			t.Errorf("handleIP(%s)[network_attrs] = %s, but we want %s", tt.input, attrs, tt.attrs)
+		}
+	}
+
+	cfg := g.CookConfig{Networks: g.NetworksConfig{CIDRs: map[string]map[string]string{"10.0.0.0": {}}}}
+	if _, err := newCooker(&cfg, nil, nil); err == nil {
+		t.Errorf("newCooker with an invalid network should fail")
+	}
+}
+
+//fakeASN knows a single address
+type fakeASN struct {
+	ip  string
+	asn ipsearch.ASN
+}
+
+func (f fakeASN) LookupASN(ip net.IP) (ipsearch.ASN, bool) {
+	return f.asn, ip.String() == f.ip
+}
+
+func TestCookEnrichASN(t *testing.T) {
+	c := newTestCooker(t, g.CookConfig{Enrich: []g.EnrichRule{
+		{Fields: []string{"src_ip"}, Enrichers: []string{"asn"}},
+		{Fields: []string{"dst_ip"}, Enrichers: []string{"geo"}},
+	}})
+	c.ipdb = fakeLookup{"8.8.8.8", ipsearch.Record{ISP: "Google", ASN: 15169, ASOrg: "GOOGLE"}}
+	c.asn = fakeASN{"8.8.8.8", ipsearch.ASN{Number: 15169, Org: "Google LLC"}}
+
+	js := cook(t, c, `{"type":"flow","src_ip":"8.8.8.8","dst_ip":"8.8.8.8"}`)
+	if v, _ := js.GetPath("src_ip", "asn", "number").Int(); v != 15169 {
+		t.Errorf("src_ip.asn.number = %v, but we want 15169", v)
+	}
+	if v, _ := js.GetPath("src_ip", "asn", "org").String(); v != "Google LLC" {
+		t.Errorf("src_ip.asn.org = %q, but we want the asn database org", v)
+	}
+	if _, ok := js.Get("src_ip").CheckGet("isp"); ok {
+		t.Errorf("src_ip.isp should only be set by the isp enricher")
+	}
+	if _, ok := js.Get("dst_ip").CheckGet("asn"); ok {
+		t.Errorf("dst_ip.asn should only be set by the asn or isp enricher")
+	}
+
+	c.asn = nil
+	m, _ := c.handleIP("8.8.8.8")
+	if asn, _ := m["asn"].(map[string]interface{}); asn["org"] != "GOOGLE" {
+		t.Errorf("handleIP(8.8.8.8)[asn] = %v, but we want the ip database asn", m["asn"])
+	}
+
+	cfg := g.CookConfig{ASN: g.ASNConfig{Backend: "whois", File: "asn.csv"}}
+	if _, err := newCooker(&cfg, nil, nil); err == nil {
+		t.Errorf("newCooker with an unknown asn backend should fail")
+	}
+}
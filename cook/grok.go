@@ -0,0 +1,145 @@
+package cook
+
+import (
+	"fmt"
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/expr"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/grok"
+	"strings"
+)
+
+//grokParseFailure is tagged on events no pattern of a matching rule could parse
+const grokParseFailure = "_grokparsefailure"
+
+//grokRule is a g.GrokRule with its paths split
+type grokRule struct {
+	types    map[string]bool
+	match    map[string][]string
+	values   map[string]string
+	field    []string
+	patterns []string
+	target   []string
+	perfData []string
+}
+
+//splitPath turn a dotted json path into simplejson branches, "" is the root
+func splitPath(path string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+//newGrokRules check every pattern compiles and returns the rules in order
+func newGrokRules(gk *grok.Grok, rules []g.GrokRule) ([]*grokRule, error) {
+	var rs []*grokRule
+	for i, rule := range rules {
+		if len(rule.Field) == 0 || len(rule.Patterns) == 0 {
+			return nil, fmt.Errorf("grok rule %d needs a field and patterns", i)
+		}
+		for _, p := range rule.Patterns {
+			if _, err := gk.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("grok rule %d: %s", i, err.Error())
+			}
+		}
+
+		r := &grokRule{
+			types:    make(map[string]bool),
+			match:    make(map[string][]string),
+			values:   rule.Match,
+			field:    splitPath(rule.Field),
+			patterns: rule.Patterns,
+			target:   splitPath(rule.Target),
+			perfData: rule.PerfData,
+		}
+		for _, t := range rule.Types {
+			r.types[t] = true
+		}
+		for path := range rule.Match {
+			r.match[path] = splitPath(path)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+//applies reports whether the event type and field conditions of the rule hold
+func (r *grokRule) applies(get expr.Getter, docType string) bool {
+	if len(r.types) > 0 && !r.types[docType] {
+		return false
+	}
+	for path, branch := range r.match {
+		if v, ok := get(branch); !ok || v != r.values[path] {
+			return false
+		}
+	}
+	return true
+}
+
+//grokApplies reports whether a rule has a text to parse in the event read by get
+func (c *Cooker) grokApplies(get expr.Getter, docType string) bool {
+	for _, r := range c.grokRules {
+		if !r.applies(get, docType) {
+			continue
+		}
+		if v, ok := get(r.field); ok {
+			if _, ok := v.(string); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//handleGrok merge the typed captures of the first matching pattern of every applicable rule
+func (c *Cooker) handleGrok(js *simplejson.Json, docType string) {
+	for _, r := range c.grokRules {
+		if !r.applies(jsonGetter(js), docType) {
+			continue
+		}
+		text, err := js.GetPath(r.field...).String()
+		if err != nil {
+			continue
+		}
+
+		matched := false
+		for _, p := range r.patterns {
+			captures, err := c.grok.ParseTyped(p, text)
+			if err != nil || len(captures) == 0 {
+				continue
+			}
+			for k, v := range captures {
+				if s, ok := v.(string); ok && contains(r.perfData, k) {
+					v = c.handlePerfData(s)
+				}
+				js.SetPath(append(r.target[:len(r.target):len(r.target)], k), v)
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			addTag(js, grokParseFailure)
+		}
+	}
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+//addTag append tag to the tags array of the event once
+func addTag(js *simplejson.Json, tag string) {
+	tags, _ := js.Get("tags").Array()
+	for _, t := range tags {
+		if t == tag {
+			return
+		}
+	}
+	js.Set("tags", append(tags, tag))
+}
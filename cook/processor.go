@@ -0,0 +1,453 @@
+package cook
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/expr"
+	"github.com/chenyoufu/yfstream/g"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//ErrDropped is returned by Cook for events a processor decided to discard
+var ErrDropped = errors.New("cook: event dropped")
+
+//Processor change an event in place, drop reports the event must be discarded
+type Processor interface {
+	Process(js *simplejson.Json) (drop bool, err error)
+}
+
+//ProcessorFunc adapts a function to a Processor
+type ProcessorFunc func(js *simplejson.Json) (bool, error)
+
+//Process call f(js)
+func (f ProcessorFunc) Process(js *simplejson.Json) (bool, error) {
+	return f(js)
+}
+
+//ProcessorFactory build a processor from its config
+type ProcessorFactory func(cfg g.ProcessorConfig) (Processor, error)
+
+var processorFactories = map[string]ProcessorFactory{
+	"set":       newSetProcessor,
+	"default":   newDefaultProcessor,
+	"rename":    newRenameProcessor,
+	"copy":      newCopyProcessor,
+	"remove":    newRemoveProcessor,
+	"convert":   newConvertProcessor,
+	"lowercase": newLowercaseProcessor,
+	"split":     newSplitProcessor,
+	"join":      newJoinProcessor,
+	"trim":      newTrimProcessor,
+	"drop_if":   newDropIfProcessor,
+	"date":      newDateProcessor,
+	"translate": newTranslateProcessor,
+	"rdns":      newRDNSProcessor,
+}
+
+//RegisterProcessor make a processor available to the cook config under name
+func RegisterProcessor(name string, f ProcessorFactory) {
+	processorFactories[name] = f
+}
+
+//processor is a configured Processor restricted to some event types and a condition
+type processor struct {
+	name  string
+	types map[string]bool
+	when  *expr.Expr
+	p     Processor
+}
+
+//newProcessors build the processor chain in config order
+func newProcessors(cfgs []g.ProcessorConfig) ([]*processor, error) {
+	var ps []*processor
+	for i, cfg := range cfgs {
+		f, ok := processorFactories[cfg.Processor]
+		if !ok {
+			return nil, fmt.Errorf("processor %d: unknown processor %q", i, cfg.Processor)
+		}
+		p, err := f(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %s", i, cfg.Processor, err.Error())
+		}
+		pr := &processor{name: cfg.Processor, types: make(map[string]bool), p: p}
+		for _, t := range cfg.Types {
+			pr.types[t] = true
+		}
+		if len(cfg.If) > 0 {
+			if pr.when, err = expr.Compile(cfg.If); err != nil {
+				return nil, fmt.Errorf("processor %d (%s): %s", i, cfg.Processor, err.Error())
+			}
+		}
+		ps = append(ps, pr)
+	}
+	return ps, nil
+}
+
+//handleProcessors run the chain, a failing processor tags the event and the chain goes on.
+//Conditions and drop rules only read the event, it is parsed by the first processor to run.
+func (c *Cooker) handleProcessors(e *event.Event, docType string) (bool, error) {
+	for _, pr := range c.processors {
+		if len(pr.types) > 0 && !pr.types[docType] {
+			continue
+		}
+		if pr.when != nil && !pr.when.Eval(e.Get) {
+			continue
+		}
+		if d, ok := pr.p.(dropIf); ok {
+			if d.drops(e.Get) {
+				return true, nil
+			}
+			continue
+		}
+		js, err := e.JSON()
+		if err != nil {
+			return false, err
+		}
+		drop, err := pr.p.Process(js)
+		if err != nil {
+			addTag(js, "_"+pr.name+"failure")
+			continue
+		}
+		if drop {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//fieldPaths returns the split paths of field and fields
+func fieldPaths(cfg g.ProcessorConfig) [][]string {
+	var paths [][]string
+	if len(cfg.Field) > 0 {
+		paths = append(paths, splitPath(cfg.Field))
+	}
+	for _, f := range cfg.Fields {
+		paths = append(paths, splitPath(f))
+	}
+	return paths
+}
+
+func requireField(cfg g.ProcessorConfig) ([]string, error) {
+	if len(cfg.Field) == 0 {
+		return nil, errors.New("field is required")
+	}
+	return splitPath(cfg.Field), nil
+}
+
+func requireTarget(cfg g.ProcessorConfig) ([]string, []string, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cfg.Target) == 0 {
+		return nil, nil, errors.New("target is required")
+	}
+	return field, splitPath(cfg.Target), nil
+}
+
+//lookup returns the value at path and whether it exists
+func lookup(js *simplejson.Json, path []string) (interface{}, bool) {
+	cur := js
+	for _, k := range path {
+		next, ok := cur.CheckGet(k)
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	return cur.Interface(), true
+}
+
+//jsonGetter let conditions read the fields of the event
+func jsonGetter(js *simplejson.Json) expr.Getter {
+	return func(path []string) (interface{}, bool) {
+		return lookup(js, path)
+	}
+}
+
+//remove delete the value at path
+func remove(js *simplejson.Json, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	js.GetPath(path[:len(path)-1]...).Del(path[len(path)-1])
+}
+
+func newSetProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		// every event gets its own copy, a later processor may change it
+		js.SetPath(field, deepCopy(cfg.Value))
+		return false, nil
+	}), nil
+}
+
+func newDefaultProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		if v, ok := lookup(js, field); !ok || v == nil || v == "" {
+			js.SetPath(field, deepCopy(cfg.Value))
+		}
+		return false, nil
+	}), nil
+}
+
+func newRenameProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, target, err := requireTarget(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		if v, ok := lookup(js, field); ok {
+			remove(js, field)
+			js.SetPath(target, v)
+		}
+		return false, nil
+	}), nil
+}
+
+//deepCopy clone the maps and slices of a decoded json value
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = deepCopy(e)
+		}
+		return l
+	}
+	return v
+}
+
+func newCopyProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, target, err := requireTarget(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		if v, ok := lookup(js, field); ok {
+			js.SetPath(target, deepCopy(v))
+		}
+		return false, nil
+	}), nil
+}
+
+func newRemoveProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	paths := fieldPaths(cfg)
+	if len(paths) == 0 {
+		return nil, errors.New("field or fields is required")
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		for _, path := range paths {
+			remove(js, path)
+		}
+		return false, nil
+	}), nil
+}
+
+//convert returns v as the json type named to
+func convert(v interface{}, to string) (interface{}, error) {
+	s := strings.TrimSpace(fmt.Sprint(v))
+	switch to {
+	case "string":
+		if v == nil {
+			return "", nil
+		}
+		return fmt.Sprint(v), nil
+	case "int":
+		if b, ok := v.(bool); ok {
+			if b {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err == nil {
+			return i, nil
+		}
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			return nil, err
+		}
+		// a float converts only when it is a whole number int64 holds
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("%s is not an integer", s)
+		}
+		if f < math.MinInt64 || f >= -math.MinInt64 {
+			return nil, fmt.Errorf("%s is out of the int range", s)
+		}
+		return int64(f), nil
+	case "float":
+		if b, ok := v.(bool); ok {
+			if b {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		}
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f != 0, nil
+		}
+		return strconv.ParseBool(s)
+	}
+	return nil, fmt.Errorf("unknown type %q", to)
+}
+
+func newConvertProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	paths := fieldPaths(cfg)
+	if len(paths) == 0 {
+		return nil, errors.New("field or fields is required")
+	}
+	if _, err := convert("0", cfg.To); err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		var lastErr error
+		for _, path := range paths {
+			v, ok := lookup(js, path)
+			if !ok {
+				continue
+			}
+			cv, err := convert(v, cfg.To)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			js.SetPath(path, cv)
+		}
+		return false, lastErr
+	}), nil
+}
+
+//newStringProcessor apply fn to the string fields, missing or non string fields are skipped
+func newStringProcessor(cfg g.ProcessorConfig, fn func(string) string) (Processor, error) {
+	paths := fieldPaths(cfg)
+	if len(paths) == 0 {
+		return nil, errors.New("field or fields is required")
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		for _, path := range paths {
+			if s, err := js.GetPath(path...).String(); err == nil {
+				js.SetPath(path, fn(s))
+			}
+		}
+		return false, nil
+	}), nil
+}
+
+func newLowercaseProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	return newStringProcessor(cfg, strings.ToLower)
+}
+
+func newTrimProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	return newStringProcessor(cfg, strings.TrimSpace)
+}
+
+func newSplitProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Separator) == 0 {
+		return nil, errors.New("separator is required")
+	}
+	target := field
+	if len(cfg.Target) > 0 {
+		target = splitPath(cfg.Target)
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		s, err := js.GetPath(field...).String()
+		if err != nil {
+			return false, nil
+		}
+		parts := strings.Split(s, cfg.Separator)
+		l := make([]interface{}, len(parts))
+		for i, p := range parts {
+			l[i] = p
+		}
+		js.SetPath(target, l)
+		return false, nil
+	}), nil
+}
+
+func newJoinProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, err
+	}
+	target := field
+	if len(cfg.Target) > 0 {
+		target = splitPath(cfg.Target)
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		l, err := js.GetPath(field...).Array()
+		if err != nil {
+			return false, nil
+		}
+		parts := make([]string, len(l))
+		for i, v := range l {
+			parts[i] = fmt.Sprint(v)
+		}
+		js.SetPath(target, strings.Join(parts, cfg.Separator))
+		return false, nil
+	}), nil
+}
+
+//dropIf drops the events having field, equal to value when it is set. It only reads
+//the event, Cook checks it without parsing.
+type dropIf struct {
+	field []string
+	value interface{}
+}
+
+func (d dropIf) drops(get expr.Getter) bool {
+	if len(d.field) == 0 {
+		return true
+	}
+	v, ok := get(d.field)
+	if !ok {
+		return false
+	}
+	if d.value == nil {
+		return true
+	}
+	return fmt.Sprint(v) == fmt.Sprint(d.value) || reflect.DeepEqual(v, d.value)
+}
+
+//Process implements Processor
+func (d dropIf) Process(js *simplejson.Json) (bool, error) {
+	return d.drops(jsonGetter(js)), nil
+}
+
+//newDropIfProcessor drop events whose field equals value, or has any value when value is unset.
+//Without a field every event passing the if condition is dropped.
+func newDropIfProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	if len(cfg.Field) == 0 && len(cfg.If) == 0 {
+		return nil, errors.New("field or if is required")
+	}
+	return dropIf{splitPath(cfg.Field), cfg.Value}, nil
+}
@@ -0,0 +1,173 @@
+package cook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/lru"
+)
+
+// longest a background reverse lookup may take
+var rdnsTimeout = 200 * time.Millisecond
+
+// cache defaults of the rdns processor and enricher
+const (
+	rdnsCacheSize   = 10000
+	rdnsCacheTTL    = time.Hour
+	rdnsNegativeTTL = time.Minute
+)
+
+// most reverse lookups a resolver runs at once, the misses beyond wait for a later event
+const rdnsConcurrency = 16
+
+//errRDNSPending is returned for an address not resolved yet
+var errRDNSPending = errors.New("rdns: lookup pending")
+
+//resolver is a reverse lookup Cook never waits for: it answers from its caches and resolves
+//the misses in the background, with a timeout, for the next events of the address
+type resolver struct {
+	r        *net.Resolver
+	timeout  time.Duration
+	positive *lru.Cache
+	negative *lru.Cache
+
+	mu      sync.Mutex
+	pending map[string]bool
+	slots   chan struct{}
+}
+
+//newResolver query server, host:port, or the system resolver when it is empty
+func newResolver(server string, timeout time.Duration, size int, ttl, negativeTTL time.Duration) *resolver {
+	r := net.DefaultResolver
+	if len(server) > 0 {
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return &resolver{
+		r:        r,
+		timeout:  timeout,
+		positive: lru.New(size, ttl),
+		negative: lru.New(size, negativeTTL),
+		pending:  make(map[string]bool),
+		slots:    make(chan struct{}, rdnsConcurrency),
+	}
+}
+
+// the resolver of the rdns enricher
+var defaultResolver = newResolver("", rdnsTimeout, rdnsCacheSize, rdnsCacheTTL, rdnsNegativeTTL)
+
+//lookup returns the cached name of ip, an address without name returns "" and no error.
+//A miss returns errRDNSPending at once and ip is resolved in the background.
+func (r *resolver) lookup(ip string) (string, error) {
+	if v, ok := r.positive.Get(ip); ok {
+		return v.(string), nil
+	}
+	if v, ok := r.negative.Get(ip); ok {
+		err, _ := v.(error)
+		return "", err
+	}
+	r.resolveAsync(ip)
+	return "", errRDNSPending
+}
+
+//resolveAsync start resolving ip unless it is in flight or every slot is busy
+func (r *resolver) resolveAsync(ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[ip] {
+		return
+	}
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		return
+	}
+	r.pending[ip] = true
+	go func() {
+		r.resolve(ip)
+		r.mu.Lock()
+		delete(r.pending, ip)
+		r.mu.Unlock()
+		<-r.slots
+	}()
+}
+
+//resolve query the first name of ip and cache the answer, an address without name returns "" and no error
+func (r *resolver) resolve(ip string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	names, err := r.r.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		if e, ok := err.(*net.DNSError); ok && e.IsNotFound {
+			err = nil
+		}
+		r.negative.Add(ip, err)
+		return "", err
+	}
+	name := strings.TrimSuffix(names[0], ".")
+	r.positive.Add(ip, name)
+	return name, nil
+}
+
+//reverseDNS returns the cached name of ip, or "" when it is not resolved yet or the lookup failed
+func reverseDNS(ip string) string {
+	name, _ := defaultResolver.lookup(ip)
+	return name
+}
+
+//newRDNSProcessor write the name of the ip at field to target. Addresses without name and the ones
+//not resolved yet are skipped, failed lookups tag the event. Timeout is in milliseconds, the ttls in seconds.
+func newRDNSProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, target, err := requireTarget(cfg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := rdnsTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Millisecond
+	}
+	size := rdnsCacheSize
+	if cfg.CacheSize > 0 {
+		size = cfg.CacheSize
+	}
+	ttl, negativeTTL := rdnsCacheTTL, rdnsNegativeTTL
+	if cfg.CacheTTL > 0 {
+		ttl = time.Duration(cfg.CacheTTL) * time.Second
+	}
+	if cfg.NegativeTTL > 0 {
+		negativeTTL = time.Duration(cfg.NegativeTTL) * time.Second
+	}
+	r := newResolver(cfg.Resolver, timeout, size, ttl, negativeTTL)
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		s, err := js.GetPath(field...).String()
+		if err != nil {
+			return false, nil
+		}
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			return false, nil
+		}
+		name, err := r.lookup(ip.String())
+		if err == errRDNSPending {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if len(name) > 0 {
+			js.SetPath(target, name)
+		}
+		return false, nil
+	}), nil
+}
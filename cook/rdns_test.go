@@ -0,0 +1,235 @@
+package cook
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+//fakeDNS answers the PTR queries of names on udp, names mapped to "" get no answer at all
+type fakeDNS struct {
+	conn    net.PacketConn
+	names   map[string]string
+	queries int32
+}
+
+func newFakeDNS(t *testing.T, names map[string]string) *fakeDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeDNS{conn: conn, names: names}
+	go s.serve()
+	return s
+}
+
+func (s *fakeDNS) addr() string { return s.conn.LocalAddr().String() }
+
+func (s *fakeDNS) close() { s.conn.Close() }
+
+func (s *fakeDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, from)
+		}
+	}
+}
+
+//answer builds the response of a single question query
+func (s *fakeDNS) answer(q []byte) []byte {
+	if len(q) < 12 {
+		return nil
+	}
+	atomic.AddInt32(&s.queries, 1)
+	// question name
+	var labels []string
+	i := 12
+	for i < len(q) && q[i] != 0 {
+		l := int(q[i])
+		if i+1+l > len(q) {
+			return nil
+		}
+		labels = append(labels, string(q[i+1:i+1+l]))
+		i += 1 + l
+	}
+	end := i + 5 // zero label, type and class
+	if end > len(q) {
+		return nil
+	}
+	name, known := s.names[strings.ToLower(strings.Join(labels, "."))]
+	if known && len(name) == 0 {
+		return nil
+	}
+
+	resp := make([]byte, 12, 512)
+	copy(resp, q[:2])
+	flags := uint16(0x8580) // response, authoritative, recursion desired and available
+	if !known {
+		flags |= 3 // nxdomain
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	if known {
+		binary.BigEndian.PutUint16(resp[6:], 1)
+	}
+	resp = append(resp, q[12:end]...)
+	if !known {
+		return resp
+	}
+	var rdata []byte
+	for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		rdata = append(rdata, byte(len(l)))
+		rdata = append(rdata, l...)
+	}
+	rdata = append(rdata, 0)
+	rr := []byte{0xc0, 12, 0, 12, 0, 1, 0, 0, 0x0e, 0x10, 0, 0}
+	binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+	return append(append(resp, rr...), rdata...)
+}
+
+func TestResolver(t *testing.T) {
+	dns := newFakeDNS(t, map[string]string{
+		"4.3.2.1.in-addr.arpa": "host.example.com.",
+		"5.3.2.1.in-addr.arpa": "",
+	})
+	defer dns.close()
+	r := newResolver(dns.addr(), 100*time.Millisecond, 10, time.Hour, time.Hour)
+
+	var tests = []struct {
+		ip   string
+		name string
+		fail bool
+	}{
+		{"1.2.3.4", "host.example.com", false},
+		{"1.2.3.6", "", false},
+		{"1.2.3.5", "", true},
+	}
+	for _, tt := range tests {
+		// the second round is served by the caches
+		for round := 0; round < 2; round++ {
+			start := time.Now()
+			lookup := r.resolve
+			if round > 0 {
+				lookup = r.lookup
+			}
+			name, err := lookup(tt.ip)
+			if name != tt.name || (err != nil) != tt.fail {
+				t.Errorf("lookup(%s) #%d = %q %v, but we want %q fail %v", tt.ip, round, name, err, tt.name, tt.fail)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("lookup(%s) #%d took %s, but we want the timeout to bound it", tt.ip, round, d)
+			}
+		}
+	}
+	if s := r.positive.Stats(); s.Hits != 1 {
+		t.Errorf("positive cache stats = %+v, but we want 1 hit", s)
+	}
+	if s := r.negative.Stats(); s.Hits != 2 {
+		t.Errorf("negative cache stats = %+v, but we want 2 hits", s)
+	}
+
+	queries := atomic.LoadInt32(&dns.queries)
+	r.lookup("1.2.3.4")
+	r.lookup("1.2.3.5")
+	if q := atomic.LoadInt32(&dns.queries); q != queries {
+		t.Errorf("cached lookups sent %d queries, but we want none", q-queries)
+	}
+}
+
+//waitRDNS returns the answer of lookup once ip is resolved in the background
+func waitRDNS(t *testing.T, lookup func() (string, error)) (string, error) {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		name, err := lookup()
+		if err != errRDNSPending {
+			return name, err
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the background lookup did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResolverAsync(t *testing.T) {
+	dns := newFakeDNS(t, map[string]string{
+		"4.3.2.1.in-addr.arpa": "host.example.com.",
+		"5.3.2.1.in-addr.arpa": "",
+	})
+	defer dns.close()
+	r := newResolver(dns.addr(), 300*time.Millisecond, 10, time.Hour, time.Hour)
+
+	for _, ip := range []string{"1.2.3.4", "1.2.3.5"} {
+		start := time.Now()
+		if _, err := r.lookup(ip); err != errRDNSPending {
+			t.Errorf("lookup(%s) = %v, but we want a pending miss", ip, err)
+		}
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Errorf("lookup(%s) took %s, but a miss should not wait for the server", ip, d)
+		}
+	}
+	if name, err := waitRDNS(t, func() (string, error) { return r.lookup("1.2.3.4") }); name != "host.example.com" || err != nil {
+		t.Errorf("lookup(1.2.3.4) = %q %v, but we want host.example.com", name, err)
+	}
+	if _, err := waitRDNS(t, func() (string, error) { return r.lookup("1.2.3.5") }); err == nil {
+		t.Errorf("lookup(1.2.3.5) should fail once the server timed out")
+	}
+}
+
+func TestCookRDNS(t *testing.T) {
+	dns := newFakeDNS(t, map[string]string{
+		"4.3.2.1.in-addr.arpa": "host.example.com.",
+		"5.3.2.1.in-addr.arpa": "",
+	})
+	defer dns.close()
+	c := newTestCooker(t, g.CookConfig{Enrich: []g.EnrichRule{}, Processors: []g.ProcessorConfig{
+		{Processor: "rdns", Field: "client", Target: "client_host", Resolver: dns.addr(), Timeout: 50},
+	}})
+
+	// a miss leaves the event as is, the next events of the address get the name
+	for _, ip := range []string{"1.2.3.4", "1.2.3.5"} {
+		js := cook(t, c, `{"type":"flow","client":"`+ip+`"}`)
+		if _, ok := js.CheckGet("client_host"); ok {
+			t.Errorf("client_host of %s should not be set before it is resolved", ip)
+		}
+		if _, ok := js.CheckGet("tags"); ok {
+			t.Errorf("a pending lookup of %s should not tag the event", ip)
+		}
+	}
+	waitRDNS(t, func() (string, error) {
+		if v, _ := cook(t, c, `{"type":"flow","client":"1.2.3.4"}`).Get("client_host").String(); len(v) > 0 {
+			return v, nil
+		}
+		return "", errRDNSPending
+	})
+	time.Sleep(100 * time.Millisecond) // the timeout of 1.2.3.5
+	js := cook(t, c, `{"type":"flow","client":"1.2.3.4"}`)
+	if v, _ := js.Get("client_host").String(); v != "host.example.com" {
+		t.Errorf("client_host = %q, but we want host.example.com", v)
+	}
+	js = cook(t, c, `{"type":"flow","client":"1.2.3.5"}`)
+	if _, ok := js.CheckGet("client_host"); ok {
+		t.Errorf("client_host should not be set when the lookup times out")
+	}
+	if tags, _ := js.Get("tags").StringArray(); len(tags) != 1 || tags[0] != "_rdnsfailure" {
+		t.Errorf("tags = %v, but we want [_rdnsfailure]", tags)
+	}
+	js = cook(t, c, `{"type":"flow","client":"not an ip"}`)
+	if _, ok := js.CheckGet("tags"); ok {
+		t.Errorf("values other than ips should be skipped")
+	}
+
+	if _, err := newRDNSProcessor(g.ProcessorConfig{Field: "client"}); err == nil {
+		t.Errorf("rdns without a target should fail")
+	}
+}
@@ -0,0 +1,92 @@
+package cook
+
+import (
+	"strings"
+
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/intel"
+)
+
+//defaultThreatFields are checked when the threat config has feeds but no fields
+var defaultThreatFields = []string{"$type.src_ip", "$type.dst_ip"}
+
+//threatMatcher is the indicators of the threat feeds and the fields checked against them
+type threatMatcher struct {
+	feeds  *intel.Feeds
+	fields [][]string
+}
+
+//newThreatMatcher returns nil when no feed is configured
+func newThreatMatcher(cfg g.ThreatConfig) (*threatMatcher, error) {
+	if len(cfg.Feeds) == 0 {
+		return nil, nil
+	}
+	var feeds []intel.Feed
+	for _, f := range cfg.Feeds {
+		name := f.Name
+		if len(name) == 0 {
+			name = f.File
+		}
+		feeds = append(feeds, intel.Feed{Name: name, File: f.File, Format: f.Format, Severity: f.Severity})
+	}
+	fs, err := intel.NewFeeds(feeds)
+	if err != nil {
+		return nil, err
+	}
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = defaultThreatFields
+	}
+	m := &threatMatcher{feeds: fs}
+	for _, f := range fields {
+		m.fields = append(m.fields, splitPath(f))
+	}
+	return m, nil
+}
+
+//threatValue returns the string to match of a field, enriched ips are matched on their dotted form
+func threatValue(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, len(t) > 0
+	case map[string]interface{}:
+		s, ok := t["dotted"].(string)
+		return s, ok
+	}
+	return "", false
+}
+
+//handleThreat set threat.matched and the most severe matching indicator, events without a match
+//are only read and left untouched
+func (c *Cooker) handleThreat(e *event.Event, docType string) error {
+	if c.threat == nil {
+		return nil
+	}
+	set := c.threat.feeds.Set()
+	var best *intel.Indicator
+	var field string
+	for _, f := range c.threat.fields {
+		path := withType(f, docType)
+		visit(e.Get, path, func(v interface{}) {
+			s, ok := threatValue(v)
+			if !ok {
+				return
+			}
+			if ind, ok := set.Match(s); ok && (best == nil || intel.Rank(ind.Severity) > intel.Rank(best.Severity)) {
+				best, field = ind, strings.Join(path, ".")
+			}
+		})
+	}
+	if best == nil {
+		return nil
+	}
+	return e.Set([]string{"threat"}, map[string]interface{}{
+		"matched":   true,
+		"indicator": best.Value,
+		"type":      best.Type,
+		"source":    best.Source,
+		"severity":  best.Severity,
+		"field":     field,
+	})
+}
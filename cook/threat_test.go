@@ -0,0 +1,68 @@
+package cook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestCookThreat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "threat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "block.txt")
+	ioutil.WriteFile(list, []byte("210.51.200.0/24\nevil.com\n"), 0644)
+	csv := filepath.Join(dir, "c2.csv")
+	ioutil.WriteFile(csv, []byte("indicator,severity\n210.51.200.123,critical\n"), 0644)
+
+	c := newEnrichCooker(t, nil)
+	c.threat, err = newThreatMatcher(g.ThreatConfig{
+		Feeds: []g.ThreatFeed{
+			{Name: "block", File: list, Severity: "medium"},
+			{Name: "c2", File: csv, Format: "csv"},
+		},
+		Fields: []string{"$type.src_ip", "$type.dst_ip", "dns.question.name", "http.urls[]"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		input     string
+		indicator string
+		severity  string
+		field     string
+	}{
+		{`{"type":"flow","flow":{"src_ip":"10.0.0.1","dst_ip":"210.51.200.9"}}`, "210.51.200.0/24", "medium", "flow.dst_ip"},
+		{`{"type":"flow","flow":{"src_ip":"210.51.200.9","dst_ip":"210.51.200.123"}}`, "210.51.200.123", "critical", "flow.dst_ip"},
+		{`{"type":"dns","dns":{"question":{"name":"www.evil.com"}}}`, "evil.com", "medium", "dns.question.name"},
+		{`{"type":"http","http":{"urls":["https://ok.org/","http://a.evil.com/x"]}}`, "evil.com", "medium", "http.urls[]"},
+		{`{"type":"flow","flow":{"src_ip":"10.0.0.1","dst_ip":"8.8.8.8"}}`, "", "", ""},
+	}
+	for _, tt := range tests {
+		js := cook(t, c, tt.input)
+		if len(tt.indicator) == 0 {
+			if _, ok := js.CheckGet("threat"); ok {
+				t.Errorf("Cook(%s) threat = %v, but we want no match", tt.input, js.Get("threat"))
+			}
+			continue
+		}
+		matched, _ := js.GetPath("threat", "matched").Bool()
+		indicator, _ := js.GetPath("threat", "indicator").String()
+		severity, _ := js.GetPath("threat", "severity").String()
+		field, _ := js.GetPath("threat", "field").String()
+		if !matched || indicator != tt.indicator || severity != tt.severity || field != tt.field {
+			t.Errorf("Cook(%s) threat = %v, but we want %s %s at %s", tt.input, js.Get("threat"), tt.indicator, tt.severity, tt.field)
+		}
+	}
+
+	cfg := g.CookConfig{Threat: g.ThreatConfig{Feeds: []g.ThreatFeed{{File: filepath.Join(dir, "missing.txt")}}}}
+	if _, err := newCooker(&cfg, nil, nil); err == nil {
+		t.Errorf("newCooker with a missing threat feed should fail")
+	}
+}
@@ -0,0 +1,210 @@
+package cook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/g"
+)
+
+//dictionary is a lookup table file, it is swapped atomically when the file changes
+type dictionary struct {
+	file    string
+	current atomic.Value
+
+	mu    sync.Mutex
+	mtime time.Time
+}
+
+func newDictionary(file string) (*dictionary, error) {
+	d := &dictionary{file: file}
+	if err := d.reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dictionary) get(key string) (interface{}, bool) {
+	v, ok := d.current.Load().(map[string]interface{})[key]
+	return v, ok
+}
+
+func (d *dictionary) reload() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fi, err := os.Stat(d.file)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(d.file)
+	if err != nil {
+		return err
+	}
+	m, err := parseDictionary(filepath.Ext(d.file), data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", d.file, err.Error())
+	}
+	d.current.Store(m)
+	d.mtime = fi.ModTime()
+	return nil
+}
+
+//watch reload the dictionary every interval its file changed
+func (d *dictionary) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		fi, err := os.Stat(d.file)
+		d.mu.Lock()
+		changed := err == nil && !fi.ModTime().Equal(d.mtime)
+		d.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := d.reload(); err != nil {
+			log.Printf("Keep the current dictionary, reload %s fail: %s", d.file, err.Error())
+			d.mu.Lock()
+			d.mtime = fi.ModTime()
+			d.mu.Unlock()
+		}
+	}
+}
+
+//parseDictionary read a json object, a key,value csv or a flat yaml mapping
+func parseDictionary(ext string, data []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	switch strings.ToLower(ext) {
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return nil, err
+		}
+	case ".csv":
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comment = '#'
+		r.FieldsPerRecord = 2
+		r.TrimLeadingSpace = true
+		for {
+			row, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			m[row[0]] = row[1]
+		}
+	case ".yaml", ".yml":
+		return parseFlatYAML(data)
+	default:
+		return nil, fmt.Errorf("unknown dictionary format %q, use .json, .csv or .yaml", ext)
+	}
+	return m, nil
+}
+
+//parseFlatYAML read "key: value" lines, nested mappings and lists are not supported
+func parseFlatYAML(data []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		s := sc.Text()
+		t := strings.TrimSpace(s)
+		if len(t) == 0 || t[0] == '#' || t == "---" {
+			continue
+		}
+		if s[0] == ' ' || s[0] == '\t' || t[0] == '-' {
+			return nil, fmt.Errorf("line %d: only flat key: value mappings are supported", line)
+		}
+		i := strings.Index(t, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: want key: value", line)
+		}
+		k, err := yamlScalar(t[:i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		v, err := yamlScalar(t[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		m[k] = v
+	}
+	return m, sc.Err()
+}
+
+//yamlScalar unquote a yaml scalar and strip its comment
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", errors.New("unterminated string")
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", errors.New("unterminated string")
+		}
+		return strings.Replace(s[1:end], "''", "'", -1), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+//newTranslateProcessor map field through the dictionary file to target, or to field itself.
+//Value is the fallback of unknown keys, without it they are left untouched.
+func newTranslateProcessor(cfg g.ProcessorConfig) (Processor, error) {
+	field, err := requireField(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Dictionary) == 0 {
+		return nil, errors.New("dictionary is required")
+	}
+	target := field
+	if len(cfg.Target) > 0 {
+		target = splitPath(cfg.Target)
+	}
+	d, err := newDictionary(cfg.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReloadInterval > 0 {
+		go d.watch(time.Duration(cfg.ReloadInterval) * time.Second)
+	}
+	return ProcessorFunc(func(js *simplejson.Json) (bool, error) {
+		v, ok := lookup(js, field)
+		if !ok || v == nil {
+			return false, nil
+		}
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false, nil
+		}
+		// the dictionary and the fallback are shared, every event gets its own copy
+		if t, ok := d.get(fmt.Sprint(v)); ok {
+			js.SetPath(target, deepCopy(t))
+		} else if cfg.Value != nil {
+			js.SetPath(target, deepCopy(cfg.Value))
+		}
+		return false, nil
+	}), nil
+}
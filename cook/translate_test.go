@@ -0,0 +1,127 @@
+package cook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestParseDictionary(t *testing.T) {
+	var tests = []struct {
+		ext   string
+		input string
+		want  map[string]string
+	}{
+		{".json", `{"404": "Not Found", "500": "Internal Server Error"}`, map[string]string{"404": "Not Found"}},
+		{".csv", "# status,text\n404,Not Found\n\"500\", \"Internal, Server Error\"\n", map[string]string{"404": "Not Found", "500": "Internal, Server Error"}},
+		{".yaml", "---\n# codes\n404: Not Found # client\n\"500\": 'it''s broken'\nhost-a: \"db #1\"\n", map[string]string{"404": "Not Found", "500": "it's broken", "host-a": "db #1"}},
+	}
+	for _, tt := range tests {
+		m, err := parseDictionary(tt.ext, []byte(tt.input))
+		if err != nil {
+			t.Errorf("parseDictionary(%s) fail: %s", tt.ext, err.Error())
+			continue
+		}
+		for k, v := range tt.want {
+			if m[k] != v {
+				t.Errorf("parseDictionary(%s)[%s] = %v, but we want %v", tt.ext, k, m[k], v)
+			}
+		}
+	}
+
+	for _, tt := range []struct{ ext, input string }{
+		{".json", "[1, 2]"},
+		{".csv", "404,Not Found,extra\n"},
+		{".yaml", "codes:\n  404: Not Found\n"},
+		{".yaml", "- 404\n"},
+		{".yml", "no colon here\n"},
+		{".xml", "<a/>"},
+	} {
+		if _, err := parseDictionary(tt.ext, []byte(tt.input)); err == nil {
+			t.Errorf("parseDictionary(%s, %q) should fail", tt.ext, tt.input)
+		}
+	}
+}
+
+func TestCookTranslate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "status.json")
+	ioutil.WriteFile(file, []byte(`{"404": "Not Found", "10.0.0.1": {"owner": "payments"}}`), 0644)
+
+	c := newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{
+		{Processor: "translate", Field: "status", Target: "status_text", Dictionary: file, Value: "unknown"},
+		{Processor: "translate", Field: "host", Target: "asset", Dictionary: file},
+	}})
+	var tests = []struct {
+		input string
+		path  []string
+		want  interface{}
+	}{
+		{`{"type":"http","status":404}`, []string{"status_text"}, "Not Found"},
+		{`{"type":"http","status":"200"}`, []string{"status_text"}, "unknown"},
+		{`{"type":"http","host":"10.0.0.1"}`, []string{"asset", "owner"}, "payments"},
+		{`{"type":"http","host":"10.0.0.2"}`, []string{"asset"}, nil},
+	}
+	for _, tt := range tests {
+		js := cook(t, c, tt.input)
+		if v, _ := lookup(js, tt.path); v != tt.want {
+			t.Errorf("Cook(%s) %v = %v, but we want %v", tt.input, tt.path, v, tt.want)
+		}
+	}
+
+	if _, err := newTranslateProcessor(g.ProcessorConfig{Field: "status"}); err == nil {
+		t.Errorf("translate without a dictionary should fail")
+	}
+	if _, err := newTranslateProcessor(g.ProcessorConfig{Field: "status", Dictionary: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Errorf("translate with a missing dictionary should fail")
+	}
+
+	// a processor changing the translated value must not change the next events
+	c = newTestCooker(t, g.CookConfig{Processors: []g.ProcessorConfig{
+		{Processor: "translate", Field: "host", Target: "asset", Dictionary: file, Value: map[string]interface{}{"owner": "none"}},
+		{Processor: "copy", Field: "user", Target: "asset.user"},
+	}})
+	for _, host := range []string{"10.0.0.1", "10.0.0.2"} {
+		cook(t, c, `{"type":"http","host":"`+host+`","user":"bob"}`)
+		js := cook(t, c, `{"type":"http","host":"`+host+`"}`)
+		if v, ok := lookup(js, []string{"asset", "user"}); ok {
+			t.Errorf("Cook(%s) asset.user = %v, but we want none", host, v)
+		}
+	}
+}
+
+func TestDictionaryReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts.csv")
+	ioutil.WriteFile(file, []byte("a,1\n"), 0644)
+	d, err := newDictionary(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go d.watch(10 * time.Millisecond)
+
+	ioutil.WriteFile(file, []byte("a,2\n"), 0644)
+	os.Chtimes(file, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if v, _ := d.get("a"); v == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("watch did not reload the changed dictionary")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,260 @@
+package cook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mssola/user_agent"
+)
+
+//uaRule name the user agents matching re, $1 in name is replaced by the first group
+type uaRule struct {
+	re      *regexp.Regexp
+	name    string
+	version string
+}
+
+//apply returns the name and version of s, ok is false when re doesn't match
+func (r *uaRule) apply(s string) (name, version string, ok bool) {
+	m := r.re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return "", "", false
+	}
+	name = string(r.re.ExpandString(nil, r.name, s, m))
+	if len(r.version) > 0 {
+		version = string(r.re.ExpandString(nil, r.version, s, m))
+		version = strings.Trim(strings.Replace(version, "_", ".", -1), ".")
+	}
+	return name, version, true
+}
+
+func mustRules(defs [][3]string) []*uaRule {
+	rules := make([]*uaRule, len(defs))
+	for i, d := range defs {
+		rules[i] = &uaRule{regexp.MustCompile(d[0]), d[1], d[2]}
+	}
+	return rules
+}
+
+//osRules normalise the os name and version, first match wins
+var osRules = mustRules([][3]string{
+	{`Windows Phone(?: OS)? ([\d.]+)`, "Windows Phone", "$1"},
+	{`Windows NT 10\.0`, "Windows", "10"},
+	{`Windows NT 6\.3`, "Windows", "8.1"},
+	{`Windows NT 6\.2`, "Windows", "8"},
+	{`Windows NT 6\.1`, "Windows", "7"},
+	{`Windows NT 6\.0`, "Windows", "Vista"},
+	{`Windows NT 5\.[12]`, "Windows", "XP"},
+	{`Windows`, "Windows", ""},
+	{`Android[ /]?([\d.]*)`, "Android", "$1"},
+	{`(?:iPhone|CPU) OS ([\d_]+)`, "iOS", "$1"},
+	{`(?:iPhone|iPad|iPod)`, "iOS", ""},
+	{`Mac OS X ([\d_.]+)`, "macOS", "$1"},
+	{`Macintosh`, "macOS", ""},
+	{`CrOS \S+ ([\d.]+)`, "Chrome OS", "$1"},
+	{`Tizen[ /]?([\d.]*)`, "Tizen", "$1"},
+	{`BlackBerry|BB10`, "BlackBerry", ""},
+	{`Ubuntu`, "Ubuntu", ""},
+	{`FreeBSD`, "FreeBSD", ""},
+	{`Linux`, "Linux", ""},
+})
+
+//deviceRules classify the device, first match wins
+var deviceRules = mustRules([][3]string{
+	{`(?i)smart-?tv|googletv|appletv|hbbtv|netcast|bravia|roku|crkey|\bAFT[A-Z]|web0s|tizen.*\btv\b`, "tv", ""},
+	{`(?i)ipad|tablet|kindle|silk/|playbook|nexus (?:7|9|10)\b`, "tablet", ""},
+	{`(?i)mobi|iphone|ipod|windows phone|blackberry|bb10|opera mini|iemobile`, "mobile", ""},
+	{`(?i)android`, "tablet", ""},
+	{`(?i)windows nt|macintosh|x11|cros`, "desktop", ""},
+})
+
+//defaultCrawlers are used when no crawler file is configured, the last rule catches the generic names
+var defaultCrawlers = mustRules([][3]string{
+	{`Googlebot(?:-(?:Image|News|Video))?`, "Googlebot", ""},
+	{`AdsBot-Google`, "AdsBot-Google", ""},
+	{`bingbot`, "Bingbot", ""},
+	{`Baiduspider`, "Baiduspider", ""},
+	{`YandexBot`, "YandexBot", ""},
+	{`DuckDuckBot`, "DuckDuckBot", ""},
+	{`Sogou (?:web|inst) spider`, "Sogou Spider", ""},
+	{`360Spider`, "360Spider", ""},
+	{`YisouSpider`, "YisouSpider", ""},
+	{`Bytespider`, "Bytespider", ""},
+	{`PetalBot`, "PetalBot", ""},
+	{`Applebot`, "Applebot", ""},
+	{`facebookexternalhit`, "Facebook", ""},
+	{`Twitterbot`, "Twitterbot", ""},
+	{`Slackbot`, "Slackbot", ""},
+	{`AhrefsBot`, "AhrefsBot", ""},
+	{`SemrushBot`, "SemrushBot", ""},
+	{`MJ12bot`, "MJ12bot", ""},
+	{`(?i)\b([\w-]*(?:bot|crawler|spider))\b`, "$1", ""},
+})
+
+//uaParser build user agent records, crawlers are matched in order
+type uaParser struct {
+	crawlers []*uaRule
+}
+
+var defaultUAParser = &uaParser{crawlers: defaultCrawlers}
+
+//newUAParser load the crawler rules of file, or use the built-in ones
+func newUAParser(file string) (*uaParser, error) {
+	if len(file) == 0 {
+		return defaultUAParser, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseCrawlers(filepath.Ext(file), data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return &uaParser{crawlers: rules}, nil
+}
+
+//parseCrawlers read a json or yaml list of {regex, name} in the ua-parser style,
+//family_replacement is accepted for name and name defaults to the first group
+func parseCrawlers(ext string, data []byte) ([]*uaRule, error) {
+	var items []map[string]string
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		var err error
+		if items, err = parseYAMLList(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown crawler list format %q, use .json or .yaml", ext)
+	}
+	var rules []*uaRule
+	for i, item := range items {
+		re, err := regexp.Compile(item["regex"])
+		if err != nil || len(item["regex"]) == 0 {
+			return nil, fmt.Errorf("crawler %d: invalid regex %q", i, item["regex"])
+		}
+		name := item["name"]
+		if len(name) == 0 {
+			name = item["family_replacement"]
+		}
+		if len(name) == 0 {
+			if re.NumSubexp() == 0 {
+				return nil, fmt.Errorf("crawler %d: name is required without a group", i)
+			}
+			name = "$1"
+		}
+		rules = append(rules, &uaRule{re: re, name: name})
+	}
+	return rules, nil
+}
+
+//parseYAMLList read a list of flat mappings, optionally under one top level key
+func parseYAMLList(data []byte) ([]map[string]string, error) {
+	var items []map[string]string
+	var cur map[string]string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		s := sc.Text()
+		t := strings.TrimSpace(s)
+		if len(t) == 0 || t[0] == '#' || t == "---" {
+			continue
+		}
+		if s[0] != ' ' && s[0] != '-' && strings.HasSuffix(t, ":") && len(items) == 0 && cur == nil {
+			continue
+		}
+		if strings.HasPrefix(t, "- ") {
+			cur = make(map[string]string)
+			items = append(items, cur)
+			t = strings.TrimSpace(t[2:])
+		} else if cur == nil {
+			return nil, fmt.Errorf("line %d: want a list of mappings", line)
+		}
+		i := strings.Index(t, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: want key: value", line)
+		}
+		k, err := yamlScalar(t[:i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		v, err := yamlScalar(t[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		cur[k] = v
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no list item")
+	}
+	return items, sc.Err()
+}
+
+//matchUA returns the name of the first rule matching s
+func matchUA(rules []*uaRule, s string) (name, version string) {
+	for _, r := range rules {
+		if n, v, ok := r.apply(s); ok {
+			return n, v
+		}
+	}
+	return "", ""
+}
+
+//parse returns the user agent record of s, every key is set even for an empty s
+func (p *uaParser) parse(s string) map[string]interface{} {
+	m := map[string]interface{}{
+		"raw":             s,
+		"browser":         "",
+		"browser_version": "",
+		"os":              "",
+		"os_name":         "",
+		"os_version":      "",
+		"platform":        "",
+		"engine":          "",
+		"engine_version":  "",
+		"device":          "",
+		"crawler":         "",
+		"bot":             false,
+	}
+	if len(strings.TrimSpace(s)) == 0 {
+		return m
+	}
+	ua := user_agent.New(s)
+	m["browser"], m["browser_version"] = ua.Browser()
+	m["os"] = ua.OS()
+	m["platform"] = ua.Platform()
+	m["engine"], m["engine_version"] = ua.Engine()
+
+	osName, osVersion := matchUA(osRules, s)
+	if len(osName) == 0 {
+		info := ua.OSInfo()
+		osName, osVersion = info.Name, info.Version
+	}
+	m["os_name"], m["os_version"] = osName, osVersion
+
+	device, _ := matchUA(deviceRules, s)
+	if len(device) == 0 {
+		device = "unknown"
+		if ua.Mobile() {
+			device = "mobile"
+		}
+	}
+	crawler, _ := matchUA(p.crawlers, s)
+	if len(crawler) > 0 || ua.Bot() {
+		device = "bot"
+	}
+	m["device"] = device
+	m["crawler"] = crawler
+	m["bot"] = len(crawler) > 0 || ua.Bot()
+	return m
+}
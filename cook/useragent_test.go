@@ -0,0 +1,103 @@
+package cook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestParseUA(t *testing.T) {
+	var tests = []struct {
+		input     string
+		osName    string
+		osVersion string
+		device    string
+		crawler   string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36", "Windows", "10", "desktop", ""},
+		{"Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko", "Windows", "7", "desktop", ""},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_4) AppleWebKit/603.1.30 (KHTML, like Gecko) Version/10.1 Safari/603.1.30", "macOS", "10.12.4", "desktop", ""},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 10_3_1 like Mac OS X) AppleWebKit/603.1.30 (KHTML, like Gecko) Version/10.0 Mobile/14E304 Safari/602.1", "iOS", "10.3.1", "mobile", ""},
+		{"Mozilla/5.0 (iPad; CPU OS 9_3_5 like Mac OS X) AppleWebKit/601.1.46 (KHTML, like Gecko) Version/9.0 Mobile/13G36 Safari/601.1", "iOS", "9.3.5", "tablet", ""},
+		{"Mozilla/5.0 (Linux; Android 7.0; SM-G930F Build/NRD90M) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/57.0.2987.132 Mobile Safari/537.36", "Android", "7.0", "mobile", ""},
+		{"Mozilla/5.0 (Linux; Android 6.0.1; SM-T810 Build/MMB29K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/57.0.2987.132 Safari/537.36", "Android", "6.0.1", "tablet", ""},
+		{"Mozilla/5.0 (X11; CrOS x86_64 9202.60.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/57.0.2987.137 Safari/537.36", "Chrome OS", "9202.60.0", "desktop", ""},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:53.0) Gecko/20100101 Firefox/53.0", "Ubuntu", "", "desktop", ""},
+		{"Mozilla/5.0 (SMART-TV; Linux; Tizen 2.4.0) AppleWebkit/538.1 (KHTML, like Gecko) SamsungBrowser/1.1 TV Safari/538.1", "Tizen", "2.4.0", "tv", ""},
+		{"Mozilla/5.0 (Linux; Android 5.1; AFTS Build/LMY47O) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/41.99900.2250.0242 Safari/537.36", "Android", "5.1", "tv", ""},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "", "", "bot", "Googlebot"},
+		{"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)", "", "", "bot", "Baiduspider"},
+		{"Mozilla/5.0 (compatible; SomeNewCrawler/1.0)", "", "", "bot", "SomeNewCrawler"},
+		{"curl/7.29.0", "", "", "unknown", ""},
+		{"", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		m := defaultUAParser.parse(tt.input)
+		if m["os_name"] != tt.osName || m["os_version"] != tt.osVersion || m["device"] != tt.device || m["crawler"] != tt.crawler {
+			t.Errorf("parse(%q) = os %v %v device %v crawler %v, but we want %v %v %v %v", tt.input,
+				m["os_name"], m["os_version"], m["device"], m["crawler"], tt.osName, tt.osVersion, tt.device, tt.crawler)
+		}
+		if m["bot"] != (len(tt.crawler) > 0) {
+			t.Errorf("parse(%q)[bot] = %v, but we want %v", tt.input, m["bot"], len(tt.crawler) > 0)
+		}
+		if len(m) != 12 {
+			t.Errorf("parse(%q) has %d keys, but we want all 12", tt.input, len(m))
+		}
+	}
+}
+
+func TestUAParserCrawlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "useragent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	yaml := filepath.Join(dir, "crawlers.yaml")
+	ioutil.WriteFile(yaml, []byte(`# ua-parser style
+user_agent_parsers:
+  - regex: '(InternalScanner)/(\d+)'
+  - regex: 'uptime-check'
+    family_replacement: 'Uptime Robot'
+`), 0644)
+	json := filepath.Join(dir, "crawlers.json")
+	ioutil.WriteFile(json, []byte(`[{"regex": "(?i)healthcheck", "name": "Health Check"}]`), 0644)
+
+	c := newTestCooker(t, g.CookConfig{UserAgent: g.UserAgentConfig{Crawlers: yaml}})
+	var tests = []struct {
+		input   string
+		crawler string
+	}{
+		{"InternalScanner/2 (+https://example.com)", "InternalScanner"},
+		{"uptime-check/1.0", "Uptime Robot"},
+		// the built-in rules are replaced
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", ""},
+	}
+	for _, tt := range tests {
+		if m := c.handleUA(tt.input); m["crawler"] != tt.crawler {
+			t.Errorf("handleUA(%q)[crawler] = %v, but we want %q", tt.input, m["crawler"], tt.crawler)
+		}
+	}
+
+	p, err := newUAParser(json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := p.parse("ELB-HealthChecker/2.0"); m["crawler"] != "Health Check" || m["device"] != "bot" {
+		t.Errorf("parse(ELB-HealthChecker/2.0) = %v, but we want the Health Check crawler", m)
+	}
+
+	for _, tt := range []struct{ ext, input string }{
+		{".yaml", "- regex: '('\n"},
+		{".yaml", "- regex: 'plain'\n"},
+		{".yaml", "regex: 'x'\n"},
+		{".json", `{"regex": "x"}`},
+		{".toml", ""},
+	} {
+		if _, err := parseCrawlers(tt.ext, []byte(tt.input)); err == nil {
+			t.Errorf("parseCrawlers(%s, %q) should fail", tt.ext, tt.input)
+		}
+	}
+}
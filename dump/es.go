@@ -2,8 +2,10 @@ package dump
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/buger/jsonparser"
+	"github.com/chenyoufu/yfstream/event"
 	"github.com/chenyoufu/yfstream/g"
 	"io"
 	"io/ioutil"
@@ -13,10 +15,14 @@ import (
 	"time"
 )
 
-//Dump2ES fetch a string from in channel,then encode to es bulk and post it non block
-func Dump2ES(in <-chan string) {
+//Dump2ES fetch an event from in channel, then encode to es bulk and post it non block.
+//The events of a bulk are settled when its post returns.
+func Dump2ES(in <-chan *event.Event) {
 	var buffer bytes.Buffer
+	var pending acks
 	var bulkCounter uint64
+	cfg := g.Config().Dump.ES
+	metadata := withMetadata()
 	dumper := time.NewTicker(1 * time.Second) // 1s
 
 	for {
@@ -26,40 +32,75 @@ func Dump2ES(in <-chan string) {
 			if buffer.Len() == 0 {
 				break
 			}
-			go dump2es(buffer.String())
+			body, events := buffer.String(), pending.take()
+			go func() { events.settle(dump2es(body)) }()
 			buffer.Reset()
-		case v := <-in:
-			bulk, err := encode2EsBulk(v)
+		case e := <-in:
+			bulk, err := encode2EsBulk(e, cfg, metadata)
 			if err != nil {
+				log.Printf("Can't encode event to es bulk: %s", err.Error())
+				e.Done(err)
 				break
 			}
-			buffer.WriteString(string(bulk))
+			buffer.Write(bulk)
+			pending.add(e)
 			bulkCounter++
 		}
 	}
 }
 
-//encode2EsBulk return esbulk formatting string
-func encode2EsBulk(msg string) ([]byte, error) {
-	prefix := g.Config().Dump.ES.IndexPrefix
-	suffix := g.Config().Dump.ES.IndexSuffix
-	docType, err := jsonparser.GetString([]byte(msg), "type")
-	if err != nil {
-		return nil, err
+// the keys of the bulk action, read in one pass over the payload
+var esBulkPaths = [][]string{{"type"}, {"guid"}}
+
+//esIndexSource returns the index segment naming the source of e, its topic, its mongodb
+//namespace or socket, and def for the other sources
+func esIndexSource(e *event.Event, def string) (string, error) {
+	for _, path := range [][]string{{"kafka", "topic"}, {"nsq", "topic"}, {"mongodb", "ns"}} {
+		if v, ok := e.Get(append([]string{event.MetadataKey}, path...)); ok {
+			return fmt.Sprint(v), nil
+		}
+	}
+	if _, ok := e.Meta["socket"]; ok {
+		return "socket", nil
+	}
+	if len(def) == 0 {
+		return "", errors.New("the source of the event has no index name and indexDefault is empty")
 	}
-	guid, err := jsonparser.GetString([]byte(msg), "guid")
+	return def, nil
+}
+
+//encode2EsBulk return esbulk formatting string, the index is named after the source
+func encode2EsBulk(e *event.Event, cfg g.ESConfig, metadata bool) ([]byte, error) {
+	msg, err := payload(e, metadata)
 	if err != nil {
 		return nil, err
 	}
-	topic, err := jsonparser.GetString([]byte(msg), "kafka", "topic")
+	var keys [2]string
+	var found [2]bool
+	jsonparser.EachKey([]byte(msg), func(i int, v []byte, t jsonparser.ValueType, err error) {
+		if err != nil || t != jsonparser.String {
+			return
+		}
+		if s, err := jsonparser.ParseString(v); err == nil {
+			keys[i], found[i] = s, true
+		}
+	}, esBulkPaths...)
+	if !found[0] || !found[1] {
+		return nil, errors.New("type and guid are required")
+	}
+	source, err := esIndexSource(e, cfg.IndexDefault)
 	if err != nil {
 		return nil, err
 	}
-	index := fmt.Sprintf("%s-%s-%s-%s", prefix, topic, guid, time.Now().Format(suffix))
+	index := fmt.Sprintf("%s-%s-%s-%s", cfg.IndexPrefix, source, keys[1], time.Now().Format(cfg.IndexSuffix))
 
-	action := fmt.Sprintf(`{create: {"_index": %s, "_type": %s}}`, index, docType)
-	bulk := fmt.Sprintf("%s\n%s\n", action, msg)
-	return []byte(bulk), nil
+	var buf bytes.Buffer
+	buf.Grow(len(msg) + len(index) + len(keys[0]) + 40)
+	fmt.Fprintf(&buf, `{create: {"_index": %s, "_type": %s}}`, index, keys[0])
+	buf.WriteByte('\n')
+	buf.WriteString(msg)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
 }
 
 // Create a new transport and HTTP client
@@ -67,15 +108,18 @@ var tr = &http.Transport{}
 var client = &http.Client{Transport: tr}
 
 //dump2es post the es bulk format string via http interface
-func dump2es(body string) {
+func dump2es(body string) error {
 	bulkURL := g.Config().Dump.ES.BulkURL
 	resp, err := client.Post(bulkURL, "text", strings.NewReader(body))
 	if err != nil {
 		log.Printf("Can't post body: %s, resp: %#v, error: %s", body, resp, err.Error())
-		return
+		return err
 	}
 
 	io.Copy(ioutil.Discard, resp.Body)
 	defer resp.Body.Close()
-	return
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("es bulk post: %s", resp.Status)
+	}
+	return nil
 }
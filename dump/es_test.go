@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestEncode2EsBulk(t *testing.T) {
+	msg := `{"type":"http","guid":"g1"}`
+	cfg := g.ESConfig{IndexPrefix: "ys", IndexSuffix: "2006", IndexDefault: "other"}
+	var tests = []struct {
+		meta  map[string]interface{}
+		index string
+	}{
+		{map[string]interface{}{"kafka": map[string]interface{}{"topic": "packetbeat"}}, "ys-packetbeat-g1-"},
+		{map[string]interface{}{"nsq": map[string]interface{}{"topic": "nginx"}}, "ys-nginx-g1-"},
+		{map[string]interface{}{"mongodb": map[string]interface{}{"ns": "logs.events"}}, "ys-logs.events-g1-"},
+		{map[string]interface{}{"socket": map[string]interface{}{"peer": "10.0.0.1:5000"}}, "ys-socket-g1-"},
+		{nil, "ys-other-g1-"},
+	}
+	for _, tt := range tests {
+		e := event.New([]byte(msg))
+		for k, v := range tt.meta {
+			e.Meta[k] = v
+		}
+		b, err := encode2EsBulk(e, cfg, false)
+		if err != nil {
+			t.Errorf("encode2EsBulk(%v) fail: %s", tt.meta, err)
+			continue
+		}
+		if want := `{create: {"_index": ` + tt.index; !strings.HasPrefix(string(b), want) || !strings.HasSuffix(string(b), "\n"+msg+"\n") {
+			t.Errorf("encode2EsBulk(%v) = %s, but we want index %s", tt.meta, b, tt.index)
+		}
+	}
+
+	// a pretty printed source message must stay one line of the bulk body
+	pretty := event.New([]byte("{\n  \"type\": \"http\",\n  \"guid\": \"g1\"\n}"))
+	if b, err := encode2EsBulk(pretty, cfg, false); err != nil || strings.Count(string(b), "\n") != 2 || !strings.HasSuffix(string(b), "\n"+msg+"\n") {
+		t.Errorf("encode2EsBulk(pretty printed) = %q, %v, but we want two lines", b, err)
+	}
+
+	if _, err := encode2EsBulk(event.New([]byte(msg)), g.ESConfig{}, false); err == nil {
+		t.Error("an event without source nor indexDefault should fail")
+	}
+	if _, err := encode2EsBulk(event.New([]byte(`{"type":"http"}`)), cfg, false); err == nil {
+		t.Error("an event without guid should fail")
+	}
+}
+
+func BenchmarkEncode2EsBulk(b *testing.B) {
+	cfg := g.ESConfig{IndexPrefix: "ys", IndexSuffix: "2006.01.02"}
+	msg := []byte(`{"type":"http","guid":"g1","@timestamp":"2017-03-01T10:00:00Z","http":{"src_ip":{"raw":"210.51.200.123","dotted":"210.51.200.123","isp":"联通"},"method":"GET","path":"/index.html","code":200}}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e := event.New(msg)
+		e.Meta["kafka"] = map[string]interface{}{"topic": "packetbeat", "partition": int32(0), "offset": int64(i)}
+		if _, err := encode2EsBulk(e, cfg, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
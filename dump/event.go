@@ -0,0 +1,46 @@
+package dump
+
+import (
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+)
+
+//payload returns what the sinks write for e, with its @metadata when dump.metadata is on
+func payload(e *event.Event, metadata bool) (string, error) {
+	var b []byte
+	var err error
+	if metadata {
+		b, err = e.BytesWithMetadata()
+	} else {
+		b, err = e.Bytes()
+	}
+	return string(b), err
+}
+
+//withMetadata reports whether the sinks write the @metadata of events
+func withMetadata() bool {
+	return g.Config().Dump.Metadata
+}
+
+//acks are the events of a batch, their sources learn whether it was written
+type acks []*event.Event
+
+func (a *acks) add(e *event.Event) {
+	if e != nil {
+		*a = append(*a, e)
+	}
+}
+
+//take returns the events and empty the batch
+func (a *acks) take() acks {
+	t := *a
+	*a = nil
+	return t
+}
+
+//settle release the hold of every event, err nil tells the write succeeded
+func (a acks) settle(err error) {
+	for _, e := range a {
+		e.Done(err)
+	}
+}
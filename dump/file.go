@@ -1 +1,326 @@
 package dump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//strftime expand the %Y %m %d %H %M %S %y %j %% verbs of layout
+func strftime(layout string, t time.Time) string {
+	if strings.IndexByte(layout, '%') < 0 {
+		return layout
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(layout); i++ {
+		c := layout[i]
+		if c != '%' || i+1 == len(layout) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch layout[i] {
+		case 'Y':
+			b.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(layout[i])
+		}
+	}
+	return b.String()
+}
+
+//rollingFile is one open NDJSON file of the file sink, acks are the events of its buffered lines
+type rollingFile struct {
+	path    string
+	f       *os.File
+	w       *bufio.Writer
+	size    int64
+	opened  time.Time
+	lastUse time.Time
+	acks    acks
+}
+
+//fileSink write messages to files named from event fields and time
+type fileSink struct {
+	path     *fieldTemplate
+	maxSize  int64
+	maxAge   time.Duration
+	idle     time.Duration
+	compress bool
+	maxOpen  int
+	now      func() time.Time
+
+	files map[string]*rollingFile
+	gzips sync.WaitGroup
+}
+
+func newFileSink(cfg g.FileDumpConfig) (*fileSink, error) {
+	path, err := parseFieldTemplate(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSink{
+		path:     path,
+		maxSize:  cfg.MaxSize,
+		maxAge:   time.Duration(cfg.Interval) * time.Second,
+		idle:     time.Duration(cfg.IdleTimeout) * time.Second,
+		compress: cfg.Compress,
+		maxOpen:  cfg.MaxOpen,
+		now:      time.Now,
+		files:    make(map[string]*rollingFile),
+	}
+	if s.maxOpen <= 0 {
+		s.maxOpen = 64
+	}
+	if s.idle <= 0 {
+		s.idle = time.Minute
+	}
+	return s, nil
+}
+
+//eventTime returns the @timestamp of msg, or now when it is missing or malformed
+func (s *fileSink) eventTime(msg []byte) time.Time {
+	if ts, err := jsonparser.GetString(msg, "@timestamp"); err == nil {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			return t
+		}
+	}
+	return s.now()
+}
+
+//write append msg as one line to the file it belongs to. The event e of msg, if any, is
+//settled once the line is flushed to the file, or with the error of the write.
+func (s *fileSink) write(msg string, e *event.Event) error {
+	fail := func(err error) error {
+		var a acks
+		a.add(e)
+		a.settle(err)
+		return err
+	}
+	t := s.eventTime([]byte(msg))
+	path, err := s.path.renderFunc([]byte(msg), func(lit string) string {
+		return strftime(lit, t)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if elem == ".." {
+			return fail(fmt.Errorf("file path %q escapes its directory", path))
+		}
+	}
+
+	rf, err := s.open(path)
+	if err != nil {
+		return fail(err)
+	}
+	n, err := rf.w.WriteString(msg)
+	if err == nil {
+		err = rf.w.WriteByte('\n')
+		n++
+	}
+	rf.size += int64(n)
+	rf.lastUse = s.now()
+	if err != nil {
+		return fail(err)
+	}
+	rf.acks.add(e)
+
+	if s.maxSize > 0 && rf.size >= s.maxSize {
+		return s.rotate(rf)
+	}
+	return nil
+}
+
+//open returns the file for path, closing the least recently used one at the handle cap
+func (s *fileSink) open(path string) (*rollingFile, error) {
+	if rf, ok := s.files[path]; ok {
+		return rf, nil
+	}
+
+	if len(s.files) >= s.maxOpen {
+		var lru *rollingFile
+		for _, rf := range s.files {
+			if lru == nil || rf.lastUse.Before(lru.lastUse) {
+				lru = rf
+			}
+		}
+		if err := s.rotate(lru); err != nil {
+			log.Printf("Can't rotate file %s: %s", lru.path, err.Error())
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	now := s.now()
+	rf := &rollingFile{
+		path:    path,
+		f:       f,
+		w:       bufio.NewWriterSize(f, 64*1024),
+		size:    fi.Size(),
+		opened:  now,
+		lastUse: now,
+	}
+	s.files[path] = rf
+	return rf, nil
+}
+
+//rotate flush, fsync and close rf and settle its events, then move it aside and gzip it if configured
+func (s *fileSink) rotate(rf *rollingFile) error {
+	delete(s.files, rf.path)
+
+	err := rf.w.Flush()
+	if e := rf.f.Sync(); err == nil {
+		err = e
+	}
+	if e := rf.f.Close(); err == nil {
+		err = e
+	}
+	rf.acks.take().settle(err)
+	if err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", rf.path, s.now().Format("20060102-150405.000000"))
+	if err := os.Rename(rf.path, rotated); err != nil {
+		return err
+	}
+	if s.compress {
+		s.gzips.Add(1)
+		go func() {
+			defer s.gzips.Done()
+			if err := gzipFile(rotated); err != nil {
+				log.Printf("Can't gzip file %s: %s", rotated, err.Error())
+			}
+		}()
+	}
+	return nil
+}
+
+//tick flush buffered lines and settle their events, and rotate files that are too old or idle.
+//Flushed lines survive a crash of the process, only a rotation fsyncs them.
+func (s *fileSink) tick() {
+	now := s.now()
+	for _, rf := range s.files {
+		expired := s.maxAge > 0 && now.Sub(rf.opened) >= s.maxAge
+		if expired || now.Sub(rf.lastUse) >= s.idle {
+			if err := s.rotate(rf); err != nil {
+				log.Printf("Can't rotate file %s: %s", rf.path, err.Error())
+			}
+			continue
+		}
+		err := rf.w.Flush()
+		if err != nil {
+			log.Printf("Can't flush file %s: %s", rf.path, err.Error())
+		}
+		rf.acks.take().settle(err)
+	}
+}
+
+//close rotate every open file and wait for the pending gzips
+func (s *fileSink) close() {
+	for _, rf := range s.files {
+		if err := s.rotate(rf); err != nil {
+			log.Printf("Can't rotate file %s: %s", rf.path, err.Error())
+		}
+	}
+	s.gzips.Wait()
+}
+
+//gzipFile compress path to path.gz and remove path
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if e := zw.Close(); err == nil {
+		err = e
+	}
+	if e := dst.Sync(); err == nil {
+		err = e
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+//Dump2File fetch an event from in channel, then append it to a rolling NDJSON file
+func Dump2File(in <-chan *event.Event) {
+	s, err := newFileSink(g.Config().Dump.File)
+	if err != nil {
+		log.Panic(err)
+	}
+	dumper := time.NewTicker(1 * time.Second)
+	metadata := withMetadata()
+
+	for {
+		select {
+		case <-dumper.C:
+			s.tick()
+		case e := <-in:
+			v, err := payload(e, metadata)
+			if err != nil {
+				log.Printf("Can't dump to file: %s", err.Error())
+				e.Done(err)
+				continue
+			}
+			// e is settled by the sink once its line is flushed
+			if err := s.write(v, e); err != nil {
+				log.Printf("Can't dump to file: %s", err.Error())
+			}
+		}
+	}
+}
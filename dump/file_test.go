@@ -0,0 +1,127 @@
+package dump
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestStrftime(t *testing.T) {
+	ts := time.Date(2016, 9, 2, 13, 6, 5, 0, time.UTC)
+	var tests = []struct {
+		layout string
+		want   string
+	}{
+		{"plain", "plain"},
+		{"%Y%m%d/%H.json", "20160902/13.json"},
+		{"%y-%j %M:%S 100%%", "16-246 06:05 100%"},
+		{"%Q%", "%Q%"},
+	}
+	for _, test := range tests {
+		if got := strftime(test.layout, ts); got != test.want {
+			t.Errorf("strftime(%q) = %q, but we want %q", test.layout, got, test.want)
+		}
+	}
+}
+
+func TestFileSinkPath(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+
+	s, _ := newFileSink(g.FileDumpConfig{Path: dir + "/{{type}}/%Y%m%d/%H.json"})
+	if err := s.write(`{"type":"http","@timestamp":"2016-09-02T13:36:05Z"}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(`{"type":"../etc"}`, nil); err == nil {
+		t.Error("a field value must not escape the directory")
+	}
+	s.tick()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "http", "20160902", "13.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "{\"type\":\"http\",\"@timestamp\":\"2016-09-02T13:36:05Z\"}\n" {
+		t.Errorf("file content = %q", b)
+	}
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+
+	s, _ := newFileSink(g.FileDumpConfig{Path: dir + "/out.json", MaxSize: 32, Compress: true})
+	for i := 0; i < 3; i++ {
+		if err := s.write(`{"type":"http","n":"0123456789"}`, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.close()
+
+	gzs, _ := filepath.Glob(filepath.Join(dir, "out.json.*.gz"))
+	if len(gzs) != 3 {
+		t.Fatalf("got %d rotated files, but we want 3", len(gzs))
+	}
+	f, _ := os.Open(gzs[0])
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(zr)
+	if !strings.HasPrefix(string(b), `{"type":"http"`) {
+		t.Errorf("rotated content = %q", b)
+	}
+}
+
+func TestFileSinkMaxOpen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+
+	s, _ := newFileSink(g.FileDumpConfig{Path: dir + "/{{type}}.json", MaxOpen: 2})
+	for _, tp := range []string{"http", "dns", "tls"} {
+		s.write(`{"type":"`+tp+`"}`, nil)
+	}
+	if len(s.files) != 2 {
+		t.Errorf("open files = %d, but we want 2", len(s.files))
+	}
+	if _, ok := s.files[dir+"/http.json"]; ok {
+		t.Error("the least recently used file should be closed")
+	}
+}
+
+func TestFileSinkAcks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+
+	var acks []error
+	newEvent := func() *event.Event {
+		e := event.New([]byte(`{}`))
+		e.SetAck(func(err error) { acks = append(acks, err) })
+		return e
+	}
+	s, _ := newFileSink(g.FileDumpConfig{Path: dir + "/{{type}}.json", MaxSize: 64})
+	s.write(`{"type":"http"}`, newEvent())
+	if len(acks) != 0 {
+		t.Fatalf("acks = %v, but a buffered line should not be settled", acks)
+	}
+	s.tick()
+	if len(acks) != 1 || acks[0] != nil {
+		t.Errorf("acks = %v after the flush, but we want one without error", acks)
+	}
+
+	// a rotation settles the lines it flushes, a failed write settles its event at once
+	s.write(`{"type":"dns","n":"01234567890123456789012345678901234567890123456789"}`, newEvent())
+	s.write(`{"type":"../etc"}`, newEvent())
+	if len(acks) != 3 || acks[1] != nil || acks[2] == nil {
+		t.Errorf("acks = %v, but we want the rotated line and the failed write", acks)
+	}
+	s.close()
+}
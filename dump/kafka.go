@@ -1 +1,243 @@
 package dump
+
+import (
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"log"
+	"time"
+)
+
+//kafkaAttempt travels in ProducerMessage.Metadata to count redeliveries
+//and settle the event once the message is delivered or dropped
+type kafkaAttempt struct {
+	retries    int
+	deadLetter bool
+	event      *event.Event
+}
+
+//settleKafka release the event of pm, if any
+func settleKafka(pm *sarama.ProducerMessage, err error) {
+	if attempt, ok := pm.Metadata.(*kafkaAttempt); ok && attempt.event != nil {
+		attempt.event.Done(err)
+	}
+}
+
+//kafkaSink publish cooked messages, retrying failed ones before dead-lettering them
+type kafkaSink struct {
+	producer   sarama.AsyncProducer
+	topic      *fieldTemplate
+	key        *fieldTemplate
+	retries    int
+	deadLetter string
+	buffer     int
+	metadata   bool
+
+	delivered uint64
+	dropped   uint64
+}
+
+//newKafkaProducerConfig translate the dump config to a sarama producer config
+func newKafkaProducerConfig(cfg g.KafkaDumpConfig) (*sarama.Config, error) {
+	c := sarama.NewConfig()
+	c.Version = sarama.V0_10_0_0
+	c.Producer.Return.Successes = true
+	c.Producer.Return.Errors = true
+
+	switch cfg.Compression {
+	case "", "none":
+		c.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		c.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		c.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		c.Producer.Compression = sarama.CompressionLZ4
+	default:
+		return nil, fmt.Errorf("unknown kafka compression %q", cfg.Compression)
+	}
+
+	switch cfg.Acks {
+	case "0":
+		c.Producer.RequiredAcks = sarama.NoResponse
+	case "", "1":
+		c.Producer.RequiredAcks = sarama.WaitForLocal
+	case "all", "-1":
+		c.Producer.RequiredAcks = sarama.WaitForAll
+	default:
+		return nil, fmt.Errorf("unknown kafka acks %q", cfg.Acks)
+	}
+
+	switch cfg.Partitioner {
+	case "", "hash":
+		c.Producer.Partitioner = sarama.NewHashPartitioner
+	case "random":
+		c.Producer.Partitioner = sarama.NewRandomPartitioner
+	case "roundrobin":
+		c.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	default:
+		return nil, fmt.Errorf("unknown kafka partitioner %q", cfg.Partitioner)
+	}
+
+	if cfg.Idempotent {
+		// the broker deduplicates only with acks=all and one request in flight
+		c.Version = sarama.V0_11_0_0
+		c.Producer.Idempotent = true
+		c.Producer.RequiredAcks = sarama.WaitForAll
+		c.Net.MaxOpenRequests = 1
+	}
+
+	if cfg.BatchSize > 0 {
+		c.Producer.Flush.Messages = cfg.BatchSize
+	}
+	if cfg.BatchBytes > 0 {
+		c.Producer.Flush.Bytes = cfg.BatchBytes
+	}
+	if cfg.FlushMs > 0 {
+		c.Producer.Flush.Frequency = time.Duration(cfg.FlushMs) * time.Millisecond
+	}
+	return c, nil
+}
+
+func newKafkaSink(producer sarama.AsyncProducer, cfg g.KafkaDumpConfig) (*kafkaSink, error) {
+	topic, err := parseFieldTemplate(cfg.Topic)
+	if err != nil {
+		return nil, err
+	}
+	k := &kafkaSink{
+		producer:   producer,
+		topic:      topic,
+		retries:    cfg.Retries,
+		deadLetter: cfg.DeadLetterTopic,
+		buffer:     cfg.BufferSize,
+	}
+	if len(cfg.KeyField) > 0 {
+		k.key, err = parseFieldTemplate("{{" + cfg.KeyField + "}}")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k.buffer <= 0 {
+		k.buffer = 1024
+	}
+	return k, nil
+}
+
+//encode build the producer message, events without the key field are spread randomly
+func (k *kafkaSink) encode(msg string) (*sarama.ProducerMessage, error) {
+	topic, err := k.topic.render([]byte(msg))
+	if err != nil {
+		return nil, err
+	}
+	pm := &sarama.ProducerMessage{
+		Topic:    topic,
+		Value:    sarama.StringEncoder(msg),
+		Metadata: &kafkaAttempt{},
+	}
+	if k.key != nil {
+		if key, err := k.key.render([]byte(msg)); err == nil {
+			pm.Key = sarama.StringEncoder(key)
+		}
+	}
+	return pm, nil
+}
+
+//retry returns the message to resend after a delivery error, nil if it is dropped
+func (k *kafkaSink) retry(perr *sarama.ProducerError) *sarama.ProducerMessage {
+	pm := perr.Msg
+	attempt, ok := pm.Metadata.(*kafkaAttempt)
+	if !ok {
+		attempt = &kafkaAttempt{}
+		pm.Metadata = attempt
+	}
+
+	if attempt.retries < k.retries {
+		attempt.retries++
+		return pm
+	}
+	if !attempt.deadLetter && len(k.deadLetter) > 0 {
+		log.Printf("Dead letter kafka message for topic %s after %d retries: %s", pm.Topic, attempt.retries, perr.Err.Error())
+		attempt.deadLetter = true
+		pm.Topic = k.deadLetter
+		return pm
+	}
+	log.Printf("Drop kafka message for topic %s: %s", pm.Topic, perr.Err.Error())
+	k.dropped++
+	return nil
+}
+
+//run feed the producer until in channel is closed and every message is settled
+func (k *kafkaSink) run(in <-chan *event.Event) {
+	var pending []*sarama.ProducerMessage
+	var inflight int
+
+	for in != nil || len(pending) > 0 || inflight > 0 {
+		var next *sarama.ProducerMessage
+		var input chan<- *sarama.ProducerMessage
+		if len(pending) > 0 {
+			next = pending[0]
+			input = k.producer.Input()
+		}
+		// stop reading new messages while the retry backlog is full
+		recv := in
+		if len(pending) >= k.buffer {
+			recv = nil
+		}
+
+		select {
+		case e, ok := <-recv:
+			if !ok {
+				in = nil
+				break
+			}
+			v, err := payload(e, k.metadata)
+			var pm *sarama.ProducerMessage
+			if err == nil {
+				pm, err = k.encode(v)
+			}
+			if err != nil {
+				log.Printf("Can't dump to kafka: %s", err.Error())
+				e.Done(nil)
+				break
+			}
+			pm.Metadata.(*kafkaAttempt).event = e
+			pending = append(pending, pm)
+		case input <- next:
+			pending = pending[1:]
+			inflight++
+		case pm := <-k.producer.Successes():
+			inflight--
+			k.delivered++
+			settleKafka(pm, nil)
+		case perr := <-k.producer.Errors():
+			inflight--
+			if pm := k.retry(perr); pm != nil {
+				pending = append(pending, pm)
+			} else {
+				settleKafka(perr.Msg, perr.Err)
+			}
+		}
+	}
+}
+
+//Dump2Kafka fetch an event from in channel, then publish it to kafka
+func Dump2Kafka(in <-chan *event.Event) {
+	cfg := g.Config().Dump.Kafka
+	kafkaConfig, err := newKafkaProducerConfig(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	producer, err := sarama.NewAsyncProducer(cfg.Brokers, kafkaConfig)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer producer.Close()
+
+	k, err := newKafkaSink(producer, cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	k.metadata = withMetadata()
+	k.run(in)
+}
@@ -0,0 +1,91 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestKafkaProducerConfig(t *testing.T) {
+	c, err := newKafkaProducerConfig(g.KafkaDumpConfig{Compression: "lz4", Acks: "1", Idempotent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Producer.Compression != sarama.CompressionLZ4 {
+		t.Errorf("compression = %v, but we want lz4", c.Producer.Compression)
+	}
+	if !c.Producer.Idempotent || c.Producer.RequiredAcks != sarama.WaitForAll || c.Net.MaxOpenRequests != 1 {
+		t.Errorf("idempotent producer must wait for all acks with one request in flight")
+	}
+
+	for _, cfg := range []g.KafkaDumpConfig{{Compression: "zstd"}, {Acks: "2"}, {Partitioner: "sticky"}} {
+		if _, err := newKafkaProducerConfig(cfg); err == nil {
+			t.Errorf("newKafkaProducerConfig(%#v) should fail", cfg)
+		}
+	}
+}
+
+func TestKafkaEncode(t *testing.T) {
+	k, err := newKafkaSink(nil, g.KafkaDumpConfig{Topic: "cooked-{{type}}", KeyField: "http.src_ip.dotted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm, err := k.encode(`{"type":"http","http":{"src_ip":{"dotted":"10.0.0.1"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm.Topic != "cooked-http" {
+		t.Errorf("topic = %q, but we want %q", pm.Topic, "cooked-http")
+	}
+	if key, _ := pm.Key.Encode(); string(key) != "10.0.0.1" {
+		t.Errorf("key = %q, but we want %q", key, "10.0.0.1")
+	}
+
+	pm, err = k.encode(`{"type":"dns"}`)
+	if err != nil || pm.Key != nil {
+		t.Errorf("event without key field should have a nil key: %#v, %v", pm, err)
+	}
+	if _, err := k.encode(`{"guid":"x"}`); err == nil {
+		t.Error("event without type should not render a topic")
+	}
+}
+
+func TestKafkaRetryAndDeadLetter(t *testing.T) {
+	c, _ := newKafkaProducerConfig(g.KafkaDumpConfig{})
+	producer := mocks.NewAsyncProducer(t, c)
+	producer.ExpectInputAndFail(errors.New("kafka: broker not available"))
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(errors.New("kafka: broker not available"))
+	producer.ExpectInputAndFail(errors.New("kafka: broker not available"))
+	producer.ExpectInputAndSucceed()
+
+	k, _ := newKafkaSink(producer, g.KafkaDumpConfig{Topic: "cooked-{{type}}", Retries: 1, DeadLetterTopic: "cooked-deadletter"})
+	var acked []error
+	send := func(msg string) {
+		e := event.New([]byte(msg))
+		e.SetAck(func(err error) { acked = append(acked, err) })
+		e.Hold(1)
+		in := make(chan *event.Event, 1)
+		in <- e
+		close(in)
+		k.run(in)
+		e.Done(nil)
+	}
+	send(`{"type":"http"}`)
+	send(`{"type":"dns"}`)
+
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if k.delivered != 2 || k.dropped != 0 {
+		t.Errorf("delivered = %d, dropped = %d, but we want 2, 0", k.delivered, k.dropped)
+	}
+	if len(acked) != 2 || acked[0] != nil || acked[1] != nil {
+		t.Errorf("acks = %v, but we want both events delivered", acked)
+	}
+}
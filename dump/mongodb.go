@@ -1 +1,133 @@
 package dump
+
+import (
+	"encoding/json"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"gopkg.in/mgo.v2"
+	"log"
+	"time"
+)
+
+type mongoInserter interface {
+	Insert(collection string, ordered bool, docs []interface{}) error
+}
+
+//mgoInserter bulk insert documents with a mgo session
+type mgoInserter struct {
+	session  *mgo.Session
+	database string
+}
+
+func (m *mgoInserter) Insert(collection string, ordered bool, docs []interface{}) error {
+	s := m.session.Copy()
+	defer s.Close()
+
+	bulk := s.DB(m.database).C(collection).Bulk()
+	if !ordered {
+		bulk.Unordered()
+	}
+	bulk.Insert(docs...)
+	_, err := bulk.Run()
+	return err
+}
+
+//mongoBatch groups documents by the collection rendered from each event
+type mongoBatch struct {
+	inserter   mongoInserter
+	collection *fieldTemplate
+	ordered    bool
+	size       int
+	pending    int
+	docs       map[string][]interface{}
+	events     acks
+}
+
+func newMongoBatch(inserter mongoInserter, collection *fieldTemplate, ordered bool, size int) *mongoBatch {
+	if size <= 0 {
+		size = 1
+	}
+	return &mongoBatch{
+		inserter:   inserter,
+		collection: collection,
+		ordered:    ordered,
+		size:       size,
+		docs:       make(map[string][]interface{}),
+	}
+}
+
+//add decode a message into its collection batch and flush when the batch is full,
+//e is settled with the batch
+func (b *mongoBatch) add(msg string, e *event.Event) error {
+	name, err := b.collection.render([]byte(msg))
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &doc); err != nil {
+		return err
+	}
+
+	b.docs[name] = append(b.docs[name], doc)
+	b.events.add(e)
+	b.pending++
+	if b.pending >= b.size {
+		b.flush()
+	}
+	return nil
+}
+
+//flush bulk insert every pending collection, the documents are dropped on failure
+func (b *mongoBatch) flush() error {
+	var lastErr error
+	for name, docs := range b.docs {
+		if err := b.inserter.Insert(name, b.ordered, docs); err != nil {
+			log.Printf("Can't insert %d docs to mongodb collection %s: %s", len(docs), name, err.Error())
+			lastErr = err
+		}
+	}
+	b.docs = make(map[string][]interface{})
+	b.pending = 0
+	b.events.take().settle(lastErr)
+	return lastErr
+}
+
+//Dump2Mongo fetch an event from in channel, then bulk insert it to mongodb
+func Dump2Mongo(in <-chan *event.Event) {
+	cfg := g.Config().Dump.Mongo
+	collection, err := parseFieldTemplate(cfg.Collection)
+	if err != nil {
+		log.Panic(err)
+	}
+	session, err := mgo.Dial(cfg.URL)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer session.Close()
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 1
+	}
+	dumper := time.NewTicker(time.Duration(interval) * time.Second)
+	inserter := &mgoInserter{session: session, database: cfg.Database}
+	batch := newMongoBatch(inserter, collection, cfg.Ordered, cfg.BatchSize)
+	metadata := withMetadata()
+
+	for {
+		select {
+		case <-dumper.C:
+			batch.flush()
+		case e := <-in:
+			v, err := payload(e, metadata)
+			if err == nil {
+				err = batch.add(v, e)
+			}
+			if err != nil {
+				// the event never made it to the batch and never will
+				log.Printf("Can't dump to mongodb: %s", err.Error())
+				e.Done(nil)
+			}
+		}
+	}
+}
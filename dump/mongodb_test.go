@@ -0,0 +1,41 @@
+package dump
+
+import (
+	"testing"
+)
+
+type fakeInserter struct {
+	inserts map[string]int
+	ordered bool
+}
+
+func (f *fakeInserter) Insert(collection string, ordered bool, docs []interface{}) error {
+	f.inserts[collection] += len(docs)
+	f.ordered = ordered
+	return nil
+}
+
+func TestMongoBatch(t *testing.T) {
+	f := &fakeInserter{inserts: map[string]int{}}
+	tpl, _ := parseFieldTemplate("cooked_{{type}}")
+	b := newMongoBatch(f, tpl, true, 3)
+
+	for _, msg := range []string{`{"type":"http"}`, `{"type":"dns"}`, `{"type":"http"}`} {
+		if err := b.add(msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.inserts["cooked_http"] != 2 || f.inserts["cooked_dns"] != 1 || !f.ordered {
+		t.Errorf("inserts = %v, ordered = %v, but we want 2 http and 1 dns ordered", f.inserts, f.ordered)
+	}
+	if b.pending != 0 {
+		t.Errorf("pending = %d, but we want 0 after a full batch", b.pending)
+	}
+
+	if err := b.add(`{"guid":"x"}`, nil); err == nil {
+		t.Error("an event without type should not render a collection")
+	}
+	if err := b.add(`{"type":`, nil); err == nil {
+		t.Error("a malformed event should be rejected")
+	}
+}
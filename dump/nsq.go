@@ -1 +1,90 @@
 package dump
+
+import (
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/nsqio/go-nsq"
+	"log"
+	"time"
+)
+
+type nsqPublisher interface {
+	MultiPublish(topic string, body [][]byte) error
+}
+
+// nsqBatch collects messages and sends them with a single MPUB
+type nsqBatch struct {
+	publisher nsqPublisher
+	topic     string
+	size      int
+	bodies    [][]byte
+	events    acks
+}
+
+func newNSQBatch(p nsqPublisher, topic string, size int) *nsqBatch {
+	if size <= 0 {
+		size = 1
+	}
+	return &nsqBatch{
+		publisher: p,
+		topic:     topic,
+		size:      size,
+		bodies:    make([][]byte, 0, size),
+	}
+}
+
+//add append a message and flush when the batch is full, e is settled with the batch
+func (b *nsqBatch) add(msg string, e *event.Event) error {
+	b.bodies = append(b.bodies, []byte(msg))
+	b.events.add(e)
+	if len(b.bodies) < b.size {
+		return nil
+	}
+	return b.flush()
+}
+
+//flush MPUB the pending messages, they are dropped on failure
+func (b *nsqBatch) flush() error {
+	if len(b.bodies) == 0 {
+		return nil
+	}
+	err := b.publisher.MultiPublish(b.topic, b.bodies)
+	b.bodies = make([][]byte, 0, b.size)
+	b.events.take().settle(err)
+	return err
+}
+
+//Dump2NSQ fetch an event from in channel, then publish to nsq in batches
+func Dump2NSQ(in <-chan *event.Event) {
+	cfg := g.Config().Dump.NSQ
+	producer, err := nsq.NewProducer(cfg.Nsqd, nsq.NewConfig())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 1
+	}
+	dumper := time.NewTicker(time.Duration(interval) * time.Second)
+	batch := newNSQBatch(producer, cfg.Topic, cfg.BatchSize)
+	metadata := withMetadata()
+
+	for {
+		select {
+		case <-dumper.C:
+			if err := batch.flush(); err != nil {
+				log.Printf("Can't publish to nsq topic %s: %s", cfg.Topic, err.Error())
+			}
+		case e := <-in:
+			v, err := payload(e, metadata)
+			if err != nil {
+				e.Done(nil)
+				break
+			}
+			if err := batch.add(v, e); err != nil {
+				log.Printf("Can't publish to nsq topic %s: %s", cfg.Topic, err.Error())
+			}
+		}
+	}
+}
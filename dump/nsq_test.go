@@ -0,0 +1,67 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/event"
+)
+
+type fakePublisher struct {
+	topics  []string
+	batches [][][]byte
+	err     error
+}
+
+func (p *fakePublisher) MultiPublish(topic string, body [][]byte) error {
+	p.topics = append(p.topics, topic)
+	p.batches = append(p.batches, body)
+	return p.err
+}
+
+func TestNSQBatch(t *testing.T) {
+	p := &fakePublisher{}
+	b := newNSQBatch(p, "cooked", 2)
+
+	for _, msg := range []string{`{"a":1}`, `{"a":2}`, `{"a":3}`} {
+		if err := b.add(msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(p.batches) != 1 || len(p.batches[0]) != 2 {
+		t.Fatalf("batches = %d, but we want one MPUB of 2", len(p.batches))
+	}
+
+	b.flush()
+	if len(p.batches) != 2 || string(p.batches[1][0]) != `{"a":3}` {
+		t.Fatalf("flush did not publish the pending message: %q", p.batches)
+	}
+	if p.topics[0] != "cooked" {
+		t.Errorf("topic = %q, but we want %q", p.topics[0], "cooked")
+	}
+
+	b.flush()
+	if len(p.batches) != 2 {
+		t.Errorf("empty flush should not publish")
+	}
+}
+
+func TestNSQBatchError(t *testing.T) {
+	p := &fakePublisher{err: errors.New("E_MPUB_FAILED")}
+	b := newNSQBatch(p, "cooked", 1)
+
+	var acked error
+	e := event.New([]byte(`{"a":1}`))
+	e.SetAck(func(err error) { acked = err })
+	e.Hold(1)
+	e.Done(nil)
+	if err := b.add(`{"a":1}`, e); err == nil {
+		t.Fatal("add should return the publish error")
+	}
+	if len(b.bodies) != 0 {
+		t.Errorf("pending = %d, but we want 0 after a failed MPUB", len(b.bodies))
+	}
+	if acked != p.err {
+		t.Errorf("ack = %v, but we want the publish error", acked)
+	}
+}
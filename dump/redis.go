@@ -1 +1,233 @@
 package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/garyburd/redigo/redis"
+	"log"
+	"strings"
+	"time"
+)
+
+//redisCmd is one pipelined command
+type redisCmd struct {
+	name string
+	args []interface{}
+}
+
+//redisSink write messages to redis lists, streams or hashes in pipelined batches
+type redisSink struct {
+	mode   string
+	push   string
+	key    *fieldTemplate
+	maxLen int64
+	ttl    int64
+	size   int
+	batch  []string
+	events acks
+}
+
+func newRedisSink(cfg g.RedisConfig) (*redisSink, error) {
+	key, err := parseFieldTemplate(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	r := &redisSink{
+		mode:   cfg.Mode,
+		push:   cfg.Push,
+		key:    key,
+		maxLen: cfg.MaxLen,
+		ttl:    cfg.TTL,
+		size:   cfg.BatchSize,
+	}
+	switch r.mode {
+	case "":
+		r.mode = "list"
+	case "list", "stream", "hash":
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+	switch r.push {
+	case "":
+		r.push = "lpush"
+	case "lpush", "rpush":
+	default:
+		return nil, fmt.Errorf("unknown redis push %q", cfg.Push)
+	}
+	if r.size <= 0 {
+		r.size = 100
+	}
+	r.batch = make([]string, 0, r.size)
+	return r, nil
+}
+
+//hashFields flatten the top level of msg into HSET field value pairs
+func hashFields(msg string) ([]interface{}, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, 0, 2*len(m))
+	for k, raw := range m {
+		var s string
+		if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+			args = append(args, k, s)
+			continue
+		}
+		args = append(args, k, string(raw))
+	}
+	return args, nil
+}
+
+//commands translate the pending batch, consecutive list pushes share one command per key
+func (r *redisSink) commands() []redisCmd {
+	var cmds []redisCmd
+	var keys []string
+	lists := make(map[string][]interface{})
+
+	for _, msg := range r.batch {
+		key, err := r.key.render([]byte(msg))
+		if err != nil {
+			log.Printf("Can't dump to redis: %s", err.Error())
+			continue
+		}
+		switch r.mode {
+		case "list":
+			if _, ok := lists[key]; !ok {
+				keys = append(keys, key)
+			}
+			lists[key] = append(lists[key], msg)
+		case "stream":
+			args := []interface{}{key}
+			if r.maxLen > 0 {
+				args = append(args, "MAXLEN", "~", r.maxLen)
+			}
+			args = append(args, "*", "data", msg)
+			cmds = append(cmds, redisCmd{"XADD", args})
+		case "hash":
+			fields, err := hashFields(msg)
+			if err != nil || len(fields) == 0 {
+				log.Printf("Can't dump to redis hash %s: not a json object", key)
+				continue
+			}
+			cmds = append(cmds, redisCmd{"HSET", append([]interface{}{key}, fields...)})
+			if r.ttl > 0 {
+				cmds = append(cmds, redisCmd{"EXPIRE", []interface{}{key, r.ttl}})
+			}
+		}
+	}
+
+	for _, key := range keys {
+		cmds = append(cmds, redisCmd{strings.ToUpper(r.push), append([]interface{}{key}, lists[key]...)})
+		if r.maxLen <= 0 {
+			continue
+		}
+		// keep the newest maxLen elements, they are at the pushed end of the list
+		if r.push == "lpush" {
+			cmds = append(cmds, redisCmd{"LTRIM", []interface{}{key, 0, r.maxLen - 1}})
+		} else {
+			cmds = append(cmds, redisCmd{"LTRIM", []interface{}{key, -r.maxLen, -1}})
+		}
+	}
+	return cmds
+}
+
+//add append msg to the batch, returns true when the batch is full. e is settled with the batch.
+func (r *redisSink) add(msg string, e *event.Event) bool {
+	r.batch = append(r.batch, msg)
+	r.events.add(e)
+	return len(r.batch) >= r.size
+}
+
+//flush pipeline the pending batch on conn, the batch is dropped on failure
+func (r *redisSink) flush(conn redis.Conn) error {
+	if len(r.batch) == 0 {
+		return nil
+	}
+	cmds := r.commands()
+	r.batch = r.batch[:0]
+	err := redisPipeline(conn, cmds)
+	r.events.take().settle(err)
+	return err
+}
+
+//redisPipeline send cmds on conn, returns the first error
+func redisPipeline(conn redis.Conn, cmds []redisCmd) error {
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd.name, cmd.args...); err != nil {
+			return err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	var firstErr error
+	for range cmds {
+		if _, err := conn.Receive(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func newRedisPool(server string) *redis.Pool {
+	connTimeout := time.Second * 2
+	readTimeout := time.Second * 2
+	writeTimeout := time.Second * 2
+
+	return &redis.Pool{
+		MaxIdle:     2,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialTimeout("tcp", server, connTimeout, readTimeout, writeTimeout)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+//Dump2Redis fetch an event from in channel, then write it to redis in pipelined batches
+func Dump2Redis(in <-chan *event.Event) {
+	cfg := g.Config().Dump.Redis
+	r, err := newRedisSink(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	pool := newRedisPool(cfg.Server)
+	defer pool.Close()
+
+	flush := func() {
+		conn := pool.Get()
+		defer conn.Close()
+		if err := r.flush(conn); err != nil {
+			log.Printf("Can't dump to redis %s: %s", cfg.Server, err.Error())
+		}
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 1
+	}
+	dumper := time.NewTicker(time.Duration(interval) * time.Second)
+	metadata := withMetadata()
+
+	for {
+		select {
+		case <-dumper.C:
+			flush()
+		case e := <-in:
+			v, err := payload(e, metadata)
+			if err != nil {
+				e.Done(nil)
+				break
+			}
+			if r.add(v, e) {
+				flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package dump
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+// fakeConn records the pipelined commands
+type fakeConn struct {
+	sent    []string
+	flushed bool
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return nil, nil
+}
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	c.sent = append(c.sent, strings.TrimSuffix(fmt.Sprintln(append([]interface{}{cmd}, args...)...), "\n"))
+	return nil
+}
+func (c *fakeConn) Flush() error                  { c.flushed = true; return nil }
+func (c *fakeConn) Receive() (interface{}, error) { return "OK", nil }
+
+func TestRedisList(t *testing.T) {
+	r, err := newRedisSink(g.RedisConfig{Key: "cooked:{{type}}", MaxLen: 10, BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.add(`{"type":"http"}`, nil)
+	r.add(`{"type":"dns"}`, nil)
+	if !r.add(`{"type":"http"}`, nil) {
+		t.Fatal("the batch should be full")
+	}
+
+	c := &fakeConn{}
+	if err := r.flush(c); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`LPUSH cooked:http {"type":"http"} {"type":"http"}`,
+		`LTRIM cooked:http 0 9`,
+		`LPUSH cooked:dns {"type":"dns"}`,
+		`LTRIM cooked:dns 0 9`,
+	}
+	if !reflect.DeepEqual(c.sent, want) || !c.flushed {
+		t.Errorf("sent = %q, but we want %q", c.sent, want)
+	}
+	if len(r.batch) != 0 {
+		t.Errorf("batch should be empty after flush")
+	}
+}
+
+func TestRedisRPushTrim(t *testing.T) {
+	r, _ := newRedisSink(g.RedisConfig{Key: "cooked", Push: "rpush", MaxLen: 5})
+	r.add(`{}`, nil)
+	c := &fakeConn{}
+	r.flush(c)
+	if c.sent[1] != "LTRIM cooked -5 -1" {
+		t.Errorf("trim = %q, but we want to keep the tail", c.sent[1])
+	}
+}
+
+func TestRedisStreamAndHash(t *testing.T) {
+	r, _ := newRedisSink(g.RedisConfig{Mode: "stream", Key: "events", MaxLen: 1000})
+	r.add(`{"type":"http"}`, nil)
+	c := &fakeConn{}
+	r.flush(c)
+	if want := `XADD events MAXLEN ~ 1000 * data {"type":"http"}`; c.sent[0] != want {
+		t.Errorf("sent = %q, but we want %q", c.sent[0], want)
+	}
+
+	r, _ = newRedisSink(g.RedisConfig{Mode: "hash", Key: "ip:{{src_ip}}", TTL: 60})
+	r.add(`{"src_ip":"10.0.0.1"}`, nil)
+	c = &fakeConn{}
+	r.flush(c)
+	want := []string{`HSET ip:10.0.0.1 src_ip 10.0.0.1`, `EXPIRE ip:10.0.0.1 60`}
+	if !reflect.DeepEqual(c.sent, want) {
+		t.Errorf("sent = %q, but we want %q", c.sent, want)
+	}
+
+	if _, err := newRedisSink(g.RedisConfig{Mode: "set"}); err == nil {
+		t.Error("unknown mode should fail")
+	}
+}
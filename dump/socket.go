@@ -1 +1,248 @@
 package dump
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/chenyoufu/yfstream/codec"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+)
+
+// how long a write may block before the connection is considered dead
+var socketWriteTimeout = 10 * time.Second
+
+// how long an event waits for room in a full send buffer before it is dropped
+var socketQueueTimeout = time.Second
+
+var errSocketFull = errors.New("socket send buffer full")
+
+// most frames written before a flush while messages are still waiting
+const socketBatchSize = 512
+
+//socketFrame is a queued message and the event it settles once flushed, e may be nil
+type socketFrame struct {
+	msg string
+	e   *event.Event
+}
+
+//socketSink forward framed messages to a tcp, udp or unix socket
+type socketSink struct {
+	network    string
+	address    string
+	codec      codec.Codec
+	tlsConfig  *tls.Config
+	queue      chan socketFrame
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	conn net.Conn
+	w    *bufio.Writer
+
+	// written since the last flush, replayed on a new connection when it fails
+	pending []string
+	acks    acks
+
+	sent    uint64
+	dropped uint64
+}
+
+//newClientTLSConfig load the CA to verify the server and the optional client certificate
+func newClientTLSConfig(cfg g.TLSConfig) (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if len(cfg.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if len(cfg.CertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+func newSocketSink(cfg g.SocketDumpConfig) (*socketSink, error) {
+	c, err := codec.New(cfg.Framing, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := &socketSink{
+		network:    cfg.Network,
+		address:    cfg.Address,
+		codec:      c,
+		queue:      make(chan socketFrame, cfg.BufferSize),
+		minBackoff: time.Duration(cfg.MinBackoffMs) * time.Millisecond,
+		maxBackoff: time.Duration(cfg.MaxBackoffMs) * time.Millisecond,
+	}
+	if cfg.TLS.Enabled {
+		if s.packet() {
+			return nil, fmt.Errorf("tls is not supported over %s", cfg.Network)
+		}
+		if s.tlsConfig, err = newClientTLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+	if s.minBackoff <= 0 {
+		s.minBackoff = 100 * time.Millisecond
+	}
+	if s.maxBackoff < s.minBackoff {
+		s.maxBackoff = 30 * time.Second
+	}
+	return s, nil
+}
+
+//packet reports whether every message goes out as its own datagram
+func (s *socketSink) packet() bool {
+	switch s.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+//enqueue put msg in the send buffer, it is dropped when the buffer stays full for socketQueueTimeout
+func (s *socketSink) enqueue(msg string, e *event.Event) bool {
+	f := socketFrame{msg, e}
+	select {
+	case s.queue <- f:
+		return true
+	default:
+	}
+	t := time.NewTimer(socketQueueTimeout)
+	defer t.Stop()
+	select {
+	case s.queue <- f:
+		return true
+	case <-t.C:
+		s.dropped++
+		return false
+	}
+}
+
+func (s *socketSink) dial() error {
+	var conn net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: socketWriteTimeout}, s.network, s.address, s.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout(s.network, s.address, socketWriteTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.w = bufio.NewWriter(conn)
+	return nil
+}
+
+func (s *socketSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+//send buffer one frame, the frames are flushed once no message is waiting
+func (s *socketSink) send(f socketFrame) {
+	s.pending = append(s.pending, f.msg)
+	s.acks.add(f.e)
+	if s.packet() || len(s.queue) == 0 || len(s.pending) >= socketBatchSize {
+		s.flush()
+	}
+}
+
+//flush write the pending frames and settle their events, the frames are written again
+//on a new connection after a failure, reconnecting with exponential backoff until it succeeds
+func (s *socketSink) flush() {
+	backoff := s.minBackoff
+	for len(s.pending) > 0 {
+		if s.conn == nil {
+			if err := s.dial(); err != nil {
+				log.Printf("Can't connect to %s://%s, retry in %s: %s", s.network, s.address, backoff, err.Error())
+				time.Sleep(backoff)
+				if backoff *= 2; backoff > s.maxBackoff {
+					backoff = s.maxBackoff
+				}
+				continue
+			}
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		err := s.write()
+		if err == nil {
+			s.sent += uint64(len(s.pending))
+			s.pending = s.pending[:0]
+			s.acks.take().settle(nil)
+			return
+		}
+		log.Printf("Can't write to %s://%s: %s", s.network, s.address, err.Error())
+		s.close()
+	}
+}
+
+//write encode every pending frame on the connection then flush it
+func (s *socketSink) write() error {
+	for _, msg := range s.pending {
+		if err := s.codec.Encode(s.w, []byte(msg)); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+//run send queued messages until the queue is closed
+func (s *socketSink) run() {
+	for f := range s.queue {
+		s.send(f)
+	}
+	s.flush()
+	s.close()
+}
+
+//Dump2Socket fetch an event from in channel, then forward it to a socket. An event is settled
+//once its frame is flushed, it fails when the queue stays full. Frames written before a broken
+//connection are written again on the next one, so the peer may receive some twice.
+func Dump2Socket(in <-chan *event.Event) {
+	cfg := g.Config().Dump.Socket
+	s, err := newSocketSink(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	go s.run()
+
+	metadata := withMetadata()
+	for e := range in {
+		v, err := payload(e, metadata)
+		if err != nil {
+			e.Done(nil)
+			continue
+		}
+		if s.enqueue(v, e) {
+			continue
+		}
+		if s.dropped%1000 == 1 {
+			log.Printf("Socket send buffer full, %d messages dropped", s.dropped)
+		}
+		e.Done(errSocketFull)
+	}
+	close(s.queue)
+}
@@ -0,0 +1,142 @@
+package dump
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/codec"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/pull"
+)
+
+//serve runs the socket input side on a local listener so frames round-trip
+func serve(t *testing.T, network, address, framing string) (string, <-chan *event.Event, func()) {
+	c, _ := codec.New(framing, 0)
+	out := make(chan *event.Event, 16)
+
+	if network == "udp" {
+		pc, err := net.ListenPacket(network, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go pull.ServePacket(pc, c, out)
+		return pc.LocalAddr().String(), out, func() { pc.Close() }
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go pull.ServeStream(ln, c, out)
+	return ln.Addr().String(), out, func() { ln.Close() }
+}
+
+func TestSocketRoundTrip(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		network string
+		address string
+		framing string
+	}{
+		{"tcp", "127.0.0.1:0", "newline"},
+		{"tcp", "127.0.0.1:0", "octet"},
+		{"unix", filepath.Join(dir, "sink.sock"), "length"},
+		{"udp", "127.0.0.1:0", "newline"},
+	}
+	for _, test := range tests {
+		addr, out, stop := serve(t, test.network, test.address, test.framing)
+		s, err := newSocketSink(g.SocketDumpConfig{Network: test.network, Address: addr, Framing: test.framing, BufferSize: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.enqueue(`{"type":"http","n":1}`, nil)
+		s.enqueue(`{"type":"http","n":2}`, nil)
+		close(s.queue)
+		s.run()
+
+		for n := 1; n <= 2; n++ {
+			select {
+			case e := <-out:
+				js, _ := e.JSON()
+				if got, _ := js.Get("n").Int(); got != n {
+					t.Errorf("%s/%s: n = %d, but we want %d", test.network, test.framing, got, n)
+				}
+				if nw, _ := e.Get([]string{event.MetadataKey, "socket", "network"}); nw != test.network {
+					t.Errorf("%s/%s: @metadata.socket.network = %v", test.network, test.framing, nw)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s/%s: message %d not received", test.network, test.framing, n)
+			}
+		}
+		stop()
+	}
+}
+
+func TestSocketBufferBound(t *testing.T) {
+	defer func(d time.Duration) { socketQueueTimeout = d }(socketQueueTimeout)
+	socketQueueTimeout = 10 * time.Millisecond
+	s, _ := newSocketSink(g.SocketDumpConfig{Network: "tcp", Address: "127.0.0.1:0", BufferSize: 2})
+	for i := 0; i < 5; i++ {
+		s.enqueue(`{}`, nil)
+	}
+	if len(s.queue) != 2 || s.dropped != 3 {
+		t.Errorf("queued = %d, dropped = %d, but we want 2, 3", len(s.queue), s.dropped)
+	}
+
+	if _, err := newSocketSink(g.SocketDumpConfig{Network: "udp", TLS: g.TLSConfig{Enabled: true}}); err == nil {
+		t.Error("tls over udp should fail")
+	}
+}
+
+//brokenConn fails every write, like a connection the peer has reset
+type brokenConn struct {
+	net.Conn
+}
+
+func (brokenConn) Write(b []byte) (int, error)        { return 0, errors.New("connection reset by peer") }
+func (brokenConn) Close() error                       { return nil }
+func (brokenConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestSocketReplay(t *testing.T) {
+	addr, out, stop := serve(t, "tcp", "127.0.0.1:0", "newline")
+	defer stop()
+	s, _ := newSocketSink(g.SocketDumpConfig{Network: "tcp", Address: addr, Framing: "newline", BufferSize: 8})
+	s.conn = brokenConn{}
+	s.w = bufio.NewWriter(s.conn)
+
+	var acks []error
+	for n := 1; n <= 2; n++ {
+		e := event.New([]byte(`{}`))
+		e.SetAck(func(err error) { acks = append(acks, err) })
+		s.enqueue(fmt.Sprintf(`{"n":%d}`, n), e)
+	}
+	// the first frame waits for the second one, nothing is settled before the flush
+	s.send(<-s.queue)
+	if len(acks) != 0 || len(s.pending) != 1 {
+		t.Fatalf("acks = %v, pending = %d before the flush, but we want none, 1", acks, len(s.pending))
+	}
+	s.send(<-s.queue)
+	if len(acks) != 2 || acks[0] != nil || acks[1] != nil {
+		t.Errorf("acks = %v, but we want both settled once written on the new connection", acks)
+	}
+	for n := 1; n <= 2; n++ {
+		select {
+		case e := <-out:
+			if b, _ := e.Bytes(); string(b) != fmt.Sprintf(`{"n":%d}`, n) {
+				t.Errorf("frame %d = %s, but we want it replayed in order", n, b)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("frame %d not replayed after the reconnect", n)
+		}
+	}
+	s.close()
+}
@@ -1 +1,183 @@
 package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+)
+
+//stdoutSink print cooked messages for debugging
+type stdoutSink struct {
+	w        io.Writer
+	format   string
+	tpl      *template.Template
+	sample   uint64
+	include  [][]string
+	exclude  [][]string
+	received uint64
+}
+
+func newStdoutSink(w io.Writer, cfg g.StdoutDumpConfig) (*stdoutSink, error) {
+	s := &stdoutSink{
+		w:      w,
+		format: cfg.Format,
+		sample: 1,
+	}
+	if cfg.Sample > 1 {
+		s.sample = uint64(cfg.Sample)
+	}
+	for _, f := range cfg.Include {
+		s.include = append(s.include, strings.Split(f, "."))
+	}
+	for _, f := range cfg.Exclude {
+		s.exclude = append(s.exclude, strings.Split(f, "."))
+	}
+
+	switch s.format {
+	case "":
+		s.format = "compact"
+	case "compact", "pretty":
+	case "template":
+		tpl, err := template.New("stdout").Option("missingkey=zero").Parse(cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		s.tpl = tpl
+	default:
+		return nil, fmt.Errorf("unknown stdout format %q", cfg.Format)
+	}
+	return s, nil
+}
+
+//getPath returns the value at path of m
+func getPath(m map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = m
+	for _, k := range path {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[k]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+//setPath set the value at path of m, creating the parent objects
+func setPath(m map[string]interface{}, path []string, v interface{}) {
+	for _, k := range path[:len(path)-1] {
+		obj, ok := m[k].(map[string]interface{})
+		if !ok {
+			obj = make(map[string]interface{})
+			m[k] = obj
+		}
+		m = obj
+	}
+	m[path[len(path)-1]] = v
+}
+
+//delPath remove the value at path of m
+func delPath(m map[string]interface{}, path []string) {
+	parent, ok := getPath(m, path[:len(path)-1])
+	if !ok {
+		return
+	}
+	if obj, ok := parent.(map[string]interface{}); ok {
+		delete(obj, path[len(path)-1])
+	}
+}
+
+//filter keep the included fields then drop the excluded ones
+func (s *stdoutSink) filter(m map[string]interface{}) map[string]interface{} {
+	if len(s.include) > 0 {
+		kept := make(map[string]interface{})
+		for _, path := range s.include {
+			if v, ok := getPath(m, path); ok {
+				setPath(kept, path, v)
+			}
+		}
+		m = kept
+	}
+	for _, path := range s.exclude {
+		delPath(m, path)
+	}
+	return m
+}
+
+//print write msg in the configured format, skipping all but 1 in sample messages
+func (s *stdoutSink) print(msg string) error {
+	s.received++
+	if (s.received-1)%s.sample != 0 {
+		return nil
+	}
+
+	if s.format == "compact" && len(s.include) == 0 && len(s.exclude) == 0 {
+		_, err := fmt.Fprintln(s.w, msg)
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(msg))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		return err
+	}
+	m = s.filter(m)
+
+	var buf bytes.Buffer
+	var err error
+	switch s.format {
+	case "compact":
+		var b []byte
+		b, err = json.Marshal(m)
+		buf.Write(b)
+	case "pretty":
+		var b []byte
+		b, err = json.MarshalIndent(m, "", "  ")
+		buf.Write(b)
+	case "template":
+		err = s.tpl.Execute(&buf, m)
+	}
+	if err != nil {
+		return err
+	}
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, err = s.w.Write(buf.Bytes())
+	return err
+}
+
+//Dump2Stdout fetch an event from in channel, then print it to stdout or stderr
+func Dump2Stdout(in <-chan *event.Event) {
+	cfg := g.Config().Dump.Stdout
+	var w io.Writer = os.Stdout
+	if cfg.Stderr {
+		w = os.Stderr
+	}
+	s, err := newStdoutSink(w, cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	metadata := withMetadata()
+	for e := range in {
+		v, err := payload(e, metadata)
+		if err == nil {
+			err = s.print(v)
+		}
+		if err != nil {
+			log.Printf("Can't dump to stdout: %s", err.Error())
+		}
+		// a debug output, its errors don't hold the source checkpoints
+		e.Done(nil)
+	}
+}
@@ -0,0 +1,50 @@
+package dump
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/g"
+)
+
+func TestStdoutFormats(t *testing.T) {
+	msg := `{"type":"http","guid":"g1","http":{"src_ip":{"dotted":"10.0.0.1","raw":167772161}},"cook_ts0":1}`
+	var tests = []struct {
+		cfg  g.StdoutDumpConfig
+		want string
+	}{
+		{g.StdoutDumpConfig{}, msg + "\n"},
+		{g.StdoutDumpConfig{Exclude: []string{"cook_ts0", "http.src_ip.raw"}}, `{"guid":"g1","http":{"src_ip":{"dotted":"10.0.0.1"}},"type":"http"}` + "\n"},
+		{g.StdoutDumpConfig{Include: []string{"type", "http.src_ip.raw"}}, `{"http":{"src_ip":{"raw":167772161}},"type":"http"}` + "\n"},
+		{g.StdoutDumpConfig{Format: "pretty", Include: []string{"type"}}, "{\n  \"type\": \"http\"\n}\n"},
+		{g.StdoutDumpConfig{Format: "template", Template: `{{.type}} {{.http.src_ip.dotted}} {{.missing}}`}, "http 10.0.0.1 <no value>\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		s, err := newStdoutSink(&buf, test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.print(msg); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("print(%#v) = %q, but we want %q", test.cfg, buf.String(), test.want)
+		}
+	}
+
+	if _, err := newStdoutSink(nil, g.StdoutDumpConfig{Format: "yaml"}); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
+
+func TestStdoutSample(t *testing.T) {
+	var buf bytes.Buffer
+	s, _ := newStdoutSink(&buf, g.StdoutDumpConfig{Sample: 3})
+	for i := 0; i < 7; i++ {
+		s.print(`{}`)
+	}
+	if buf.String() != "{}\n{}\n{}\n" {
+		t.Errorf("sampled output = %q, but we want 3 lines", buf.String())
+	}
+}
@@ -0,0 +1,98 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"strings"
+)
+
+//fieldTemplate renders names such as "cooked-{{type}}" from event fields
+type fieldTemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+//templatePart is either a literal or a dotted json path
+type templatePart struct {
+	literal string
+	path    []string
+}
+
+//parseFieldTemplate split the template into literals and {{field.path}} references
+func parseFieldTemplate(s string) (*fieldTemplate, error) {
+	t := &fieldTemplate{raw: s}
+	rest := s
+	for len(rest) > 0 {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed {{ in template %q", s)
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:start]})
+		}
+		name := strings.TrimSpace(rest[start+2 : start+end])
+		if len(name) == 0 {
+			return nil, fmt.Errorf("empty field in template %q", s)
+		}
+		t.parts = append(t.parts, templatePart{path: strings.Split(name, ".")})
+		rest = rest[start+end+2:]
+	}
+	return t, nil
+}
+
+//static reports whether the template does not reference any field
+func (t *fieldTemplate) static() bool {
+	for _, p := range t.parts {
+		if p.path != nil {
+			return false
+		}
+	}
+	return true
+}
+
+//render return the template filled with the fields of msg, a static template is returned as is
+func (t *fieldTemplate) render(msg []byte) (string, error) {
+	if t.static() {
+		return t.raw, nil
+	}
+	return t.renderFunc(msg, nil)
+}
+
+//renderFunc is render with the literal parts passed through fn, e.g. to expand time verbs
+func (t *fieldTemplate) renderFunc(msg []byte, fn func(string) string) (string, error) {
+	var buf bytes.Buffer
+	for _, p := range t.parts {
+		if p.path == nil {
+			if fn != nil {
+				buf.WriteString(fn(p.literal))
+			} else {
+				buf.WriteString(p.literal)
+			}
+			continue
+		}
+		v, vt, _, err := jsonparser.Get(msg, p.path...)
+		if err != nil {
+			return "", fmt.Errorf("field %s not found for template %q", strings.Join(p.path, "."), t.raw)
+		}
+		if vt == jsonparser.String {
+			s, err := jsonparser.ParseString(v)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(s)
+			continue
+		}
+		buf.Write(v)
+	}
+	return buf.String(), nil
+}
+
+func (t *fieldTemplate) String() string {
+	return t.raw
+}
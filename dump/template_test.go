@@ -0,0 +1,39 @@
+package dump
+
+import (
+	"testing"
+)
+
+func TestFieldTemplate(t *testing.T) {
+	msg := []byte(`{"type":"http","http":{"src_ip":{"dotted":"10.0.0.1"},"port":80}}`)
+	var tests = []struct {
+		tpl  string
+		want string
+	}{
+		{"cooked", "cooked"},
+		{"cooked-{{type}}", "cooked-http"},
+		{"{{ http.src_ip.dotted }}:{{http.port}}", "10.0.0.1:80"},
+	}
+	for _, test := range tests {
+		tpl, err := parseFieldTemplate(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := tpl.render(msg); err != nil || got != test.want {
+			t.Errorf("render(%q) = %q, %v, but we want %q", test.tpl, got, err, test.want)
+		}
+	}
+
+	if _, err := parseFieldTemplate("cooked-{{type"); err == nil {
+		t.Error("unclosed template should fail to parse")
+	}
+	tpl, _ := parseFieldTemplate("{{guid}}")
+	if _, err := tpl.render(msg); err == nil {
+		t.Error("missing field should fail to render")
+	}
+	// a static name is not looked up in the message
+	tpl, _ = parseFieldTemplate("cooked")
+	if got, err := tpl.render([]byte(`not json`)); !tpl.static() || err != nil || got != "cooked" {
+		t.Errorf("render(cooked) = %q, %v, but we want the static name", got, err)
+	}
+}
@@ -0,0 +1,270 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/buger/jsonparser"
+)
+
+// MetadataKey is the root of the paths Get resolves in Meta rather than in the payload
+const MetadataKey = "@metadata"
+
+// stages stamped by the pipeline
+const (
+	StageInput = "input" // received from the source
+	StageCook  = "cook"  // Cook started
+	StageRoute = "route" // cooked and handed to the routed outputs
+	StageAck   = "ack"   // every output settled the event
+)
+
+//Stamp is the time an event reached a stage
+type Stamp struct {
+	Stage string
+	Time  time.Time
+}
+
+//Event is a message on its way through the pipeline, the envelope of a json payload.
+//The payload is parsed at most once, on the first change, and encoded again only when
+//it was changed. Meta and the stamps travel with it but are not part of the payload.
+type Event struct {
+	raw   []byte
+	js    *simplejson.Json
+	dirty bool
+
+	//Meta is the @metadata of the event, the sources put their coordinates here
+	Meta map[string]interface{}
+
+	mu      sync.Mutex
+	stamps  []Stamp
+	ack     func(error)
+	pending int32
+	err     error
+}
+
+//New returns the event of a json payload, raw is not copied and must not be changed.
+//The event is held once by the pipeline, see Hold and Done.
+func New(raw []byte) *Event {
+	return &Event{
+		raw:     raw,
+		Meta:    make(map[string]interface{}),
+		stamps:  []Stamp{{StageInput, time.Now()}},
+		pending: 1,
+	}
+}
+
+//Stamp record that the event reached stage now
+func (e *Event) Stamp(stage string) time.Time {
+	now := time.Now()
+	e.mu.Lock()
+	e.stamps = append(e.stamps, Stamp{stage, now})
+	e.mu.Unlock()
+	return now
+}
+
+//Stamps returns the stages the event reached, in order
+func (e *Event) Stamps() []Stamp {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Stamp(nil), e.stamps...)
+}
+
+//StampOf returns the first time the event reached stage
+func (e *Event) StampOf(stage string) (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.stamps {
+		if s.Stage == stage {
+			return s.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+//SetAck set the callback of the source, it is called once with the first error
+//when every hold of the event is done
+func (e *Event) SetAck(ack func(error)) {
+	e.ack = ack
+}
+
+//Hold expect n more Done calls before the event is acknowledged, an output
+//holds the event until it is written
+func (e *Event) Hold(n int) {
+	atomic.AddInt32(&e.pending, int32(n))
+}
+
+//Done release one hold, err tells the source the event was not delivered
+func (e *Event) Done(err error) {
+	if err != nil {
+		e.mu.Lock()
+		if e.err == nil {
+			e.err = err
+		}
+		e.mu.Unlock()
+	}
+	if atomic.AddInt32(&e.pending, -1) != 0 {
+		return
+	}
+	e.Stamp(StageAck)
+	if e.ack != nil {
+		e.mu.Lock()
+		err := e.err
+		e.mu.Unlock()
+		e.ack(err)
+	}
+}
+
+//JSON returns the parsed message, the event is considered changed from then on
+func (e *Event) JSON() (*simplejson.Json, error) {
+	if e.js == nil {
+		js, err := simplejson.NewJson(e.raw)
+		if err != nil {
+			return nil, err
+		}
+		e.js = js
+	}
+	e.dirty = true
+	return e.js, nil
+}
+
+//Valid reports whether the payload is well-formed json, a scan that does not parse it
+func (e *Event) Valid() bool {
+	return e.js != nil || json.Valid(e.raw)
+}
+
+//Set the value at path
+func (e *Event) Set(path []string, v interface{}) error {
+	js, err := e.JSON()
+	if err != nil {
+		return err
+	}
+	js.SetPath(path, v)
+	return nil
+}
+
+//Get returns the value at path, an unparsed message is only scanned for it.
+//Paths under @metadata are read from Meta. Its signature is the one of expr.Getter.
+func (e *Event) Get(path []string) (interface{}, bool) {
+	if len(path) > 0 && path[0] == MetadataKey {
+		var cur interface{} = e.Meta
+		for _, k := range path[1:] {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[k]; !ok {
+				return nil, false
+			}
+		}
+		return cur, true
+	}
+	if e.js != nil {
+		cur := e.js
+		for _, k := range path {
+			next, ok := cur.CheckGet(k)
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		}
+		return cur.Interface(), true
+	}
+	v, t, _, err := jsonparser.Get(e.raw, path...)
+	if err != nil {
+		return nil, false
+	}
+	switch t {
+	case jsonparser.String:
+		s, err := jsonparser.ParseString(v)
+		return s, err == nil
+	case jsonparser.Number:
+		return json.Number(v), true
+	case jsonparser.Boolean:
+		return v[0] == 't', true
+	case jsonparser.Null:
+		return nil, true
+	}
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(v))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+//String returns the string at path
+func (e *Event) String(path ...string) (string, error) {
+	v, ok := e.Get(path)
+	if !ok {
+		return "", errors.New("key path not found")
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("value is not a string")
+	}
+	return s, nil
+}
+
+//Bytes returns the json of the payload on one line, the message itself when it was not changed
+//and has no line break. It must be called once before the event is shared by several outputs.
+func (e *Event) Bytes() ([]byte, error) {
+	if !e.dirty {
+		// a pretty printed message would break the newline framed outputs
+		if bytes.IndexAny(e.raw, "\r\n") >= 0 {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, e.raw); err != nil {
+				return nil, err
+			}
+			e.raw = buf.Bytes()
+		}
+		return e.raw, nil
+	}
+	b, err := e.js.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	// the tree is kept, a later change marshals it again
+	e.raw, e.dirty = b, false
+	return b, nil
+}
+
+//BytesWithMetadata returns the payload with Meta and the stamps, in unix microseconds,
+//under @metadata. The payload must have been encoded by Bytes already.
+func (e *Event) BytesWithMetadata() ([]byte, error) {
+	b, err := e.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]interface{}, len(e.Meta)+1)
+	for k, v := range e.Meta {
+		meta[k] = v
+	}
+	stamps := make(map[string]int64)
+	for _, s := range e.Stamps() {
+		if _, ok := stamps[s.Stage]; !ok {
+			stamps[s.Stage] = s.Time.UnixNano() / 1000
+		}
+	}
+	meta["stamps"] = stamps
+	mb, err := json.Marshal(map[string]interface{}{MetadataKey: meta})
+	if err != nil {
+		return nil, err
+	}
+	// splice {"@metadata":...} into the payload object instead of parsing it again
+	body := bytes.TrimRight(b, " \t\r\n")
+	if len(body) < 2 || body[len(body)-1] != '}' {
+		return nil, errors.New("payload is not a json object")
+	}
+	out := make([]byte, 0, len(body)+len(mb))
+	out = append(out, body[:len(body)-1]...)
+	if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+		out = append(out, ',')
+	}
+	return append(out, mb[1:]...), nil
+}
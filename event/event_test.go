@@ -0,0 +1,159 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+const msg = `{"type":"http","n":42,"ok":true,"none":null,"http":{"src_ip":"10.0.0.1","urls":["/a","/b"]},"s":"a\"b"}`
+
+func TestGet(t *testing.T) {
+	var tests = []struct {
+		path []string
+		want string
+		ok   bool
+	}{
+		{[]string{"type"}, "http", true},
+		{[]string{"n"}, "42", true},
+		{[]string{"ok"}, "true", true},
+		{[]string{"none"}, "<nil>", true},
+		{[]string{"s"}, `a"b`, true},
+		{[]string{"http", "src_ip"}, "10.0.0.1", true},
+		{[]string{"http", "urls"}, "[/a /b]", true},
+		{[]string{"http"}, "map[src_ip:10.0.0.1 urls:[/a /b]]", true},
+		{[]string{"http", "dst_ip"}, "<nil>", false},
+		{[]string{"type", "x"}, "<nil>", false},
+	}
+	parsed := New([]byte(msg))
+	parsed.JSON()
+	for _, e := range []*Event{New([]byte(msg)), parsed} {
+		for _, tt := range tests {
+			v, ok := e.Get(tt.path)
+			if got := fmt.Sprint(v); got != tt.want || ok != tt.ok {
+				t.Errorf("Get(%v) = %s, %v, but we want %s, %v (parsed %v)", tt.path, got, ok, tt.want, tt.ok, e.js != nil)
+			}
+		}
+	}
+	if n, ok := New([]byte(msg)).Get([]string{"n"}); n != json.Number("42") || !ok {
+		t.Errorf("Get(n) = %#v, but we want a json.Number", n)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	raw := []byte(msg)
+	e := New(raw)
+	if s, _ := e.String("type"); s != "http" {
+		t.Errorf("String(type) = %q, but we want %q", s, "http")
+	}
+	b, err := e.Bytes()
+	if err != nil || &b[0] != &raw[0] {
+		t.Errorf("Bytes() of an unchanged event should be its message")
+	}
+	if e.js != nil {
+		t.Errorf("reading a field should not parse the message")
+	}
+
+	if err := e.Set([]string{"kafka", "topic"}, "packetbeat"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if topic := doc["kafka"].(map[string]interface{})["topic"]; topic != "packetbeat" {
+		t.Errorf("kafka.topic = %v, but we want packetbeat", topic)
+	}
+	if b2, _ := e.Bytes(); &b2[0] != &b[0] {
+		t.Errorf("Bytes() marshal again an unchanged event")
+	}
+	pretty := "{\n  \"type\": \"http\",\r\n  \"http\": {\"urls\": [\"/a\", \"/b c\"]}\n}\n"
+	if b, err := New([]byte(pretty)).Bytes(); string(b) != `{"type":"http","http":{"urls":["/a","/b c"]}}` || err != nil {
+		t.Errorf("Bytes() of a pretty printed message = %s, %v, but we want it on one line", b, err)
+	}
+	if _, err := New([]byte("{\"type\":\n")).Bytes(); err == nil {
+		t.Errorf("Bytes() of an invalid multi-line message should fail")
+	}
+	if _, err := New([]byte(`{"type":`)).JSON(); err == nil {
+		t.Errorf("JSON() of an invalid message should fail")
+	}
+}
+
+func TestAck(t *testing.T) {
+	var acks []error
+	e := New([]byte(msg))
+	e.SetAck(func(err error) { acks = append(acks, err) })
+
+	// two outputs, the second one fails
+	e.Hold(2)
+	e.Done(nil)
+	e.Done(nil)
+	if len(acks) != 0 {
+		t.Fatalf("acked before every hold is done")
+	}
+	e.Done(errors.New("sink down"))
+	if len(acks) != 1 || acks[0] == nil || acks[0].Error() != "sink down" {
+		t.Errorf("acks = %v, but we want one with the output error", acks)
+	}
+	if _, ok := e.StampOf(StageAck); !ok {
+		t.Errorf("the ack should be stamped")
+	}
+
+	acks = nil
+	e = New([]byte(msg))
+	e.SetAck(func(err error) { acks = append(acks, err) })
+	e.Done(nil)
+	if len(acks) != 1 || acks[0] != nil {
+		t.Errorf("acks = %v, but we want one without error", acks)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	e := New([]byte(msg))
+	e.Meta["kafka"] = map[string]interface{}{"topic": "packetbeat", "offset": int64(7)}
+	e.Stamp(StageCook)
+
+	if v, ok := e.Get([]string{MetadataKey, "kafka", "topic"}); !ok || v != "packetbeat" {
+		t.Errorf("Get(@metadata.kafka.topic) = %v, %v, but we want packetbeat", v, ok)
+	}
+	if _, ok := e.Get([]string{"kafka"}); ok {
+		t.Errorf("metadata should not be in the payload")
+	}
+	if b, _ := e.Bytes(); string(b) != msg {
+		t.Errorf("Bytes() = %s, but we want the payload only", b)
+	}
+
+	b, err := e.BytesWithMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Type string `json:"type"`
+		Meta struct {
+			Kafka  map[string]interface{} `json:"kafka"`
+			Stamps map[string]int64       `json:"stamps"`
+		} `json:"@metadata"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("BytesWithMetadata() = %s: %s", b, err)
+	}
+	input, _ := e.StampOf(StageInput)
+	if doc.Type != "http" || doc.Meta.Kafka["topic"] != "packetbeat" || doc.Meta.Stamps[StageInput] != input.UnixNano()/1000 {
+		t.Errorf("BytesWithMetadata() = %s, but we want the payload with kafka and stamps", b)
+	}
+	if _, ok := doc.Meta.Stamps[StageCook]; !ok {
+		t.Errorf("BytesWithMetadata() = %s, but we want the cook stamp", b)
+	}
+
+	if b, _ := New([]byte(`{}`)).BytesWithMetadata(); !json.Valid(b) {
+		t.Errorf("BytesWithMetadata() of an empty object = %s, but we want valid json", b)
+	}
+	if _, err := New([]byte(`[1]`)).BytesWithMetadata(); err == nil {
+		t.Errorf("BytesWithMetadata() of an array should fail")
+	}
+}
@@ -0,0 +1,297 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Getter returns the value at a field path and whether it exists
+type Getter func(path []string) (interface{}, bool)
+
+//MapGetter walk the maps of a decoded json document
+func MapGetter(doc interface{}) Getter {
+	return func(path []string) (interface{}, bool) {
+		cur := doc
+		for _, k := range path {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[k]; !ok {
+				return nil, false
+			}
+		}
+		return cur, true
+	}
+}
+
+//Eval reports whether the condition holds for the fields get returns
+func (e *Expr) Eval(get Getter) bool {
+	return e.root.eval(get)
+}
+
+//EvalJSON decode msg and evaluate the condition on it, invalid json never matches
+func (e *Expr) EvalJSON(msg []byte) bool {
+	var doc interface{}
+	if err := json.Unmarshal(msg, &doc); err != nil {
+		return false
+	}
+	return e.Eval(MapGetter(doc))
+}
+
+type node interface {
+	eval(get Getter) bool
+}
+
+type operand interface {
+	value(get Getter) (interface{}, bool)
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (l literal) value(Getter) (interface{}, bool) {
+	return l.v, true
+}
+
+type pathOperand []string
+
+func (p pathOperand) value(get Getter) (interface{}, bool) {
+	return get(p)
+}
+
+type orNode struct{ l, r node }
+
+func (n *orNode) eval(get Getter) bool { return n.l.eval(get) || n.r.eval(get) }
+
+type andNode struct{ l, r node }
+
+func (n *andNode) eval(get Getter) bool { return n.l.eval(get) && n.r.eval(get) }
+
+type notNode struct{ n node }
+
+func (n *notNode) eval(get Getter) bool { return !n.n.eval(get) }
+
+type existsNode struct{ path []string }
+
+func (n *existsNode) eval(get Getter) bool {
+	_, ok := get(n.path)
+	return ok
+}
+
+//truthNode holds for present values other than null, false, 0 and ""
+type truthNode struct{ o operand }
+
+func (n *truthNode) eval(get Getter) bool {
+	v, ok := n.o.value(get)
+	if !ok || v == nil {
+		return false
+	}
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return len(t) > 0
+	}
+	if f, ok := number(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+type cmpNode struct {
+	op   string
+	l, r operand
+}
+
+func (n *cmpNode) eval(get Getter) bool {
+	l, lok := n.l.value(get)
+	r, rok := n.r.value(get)
+	if !lok || !rok {
+		return n.op == "!=" && lok != rok
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+	c, ok := compare(l, r)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+type matchNode struct {
+	o      operand
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n *matchNode) eval(get Getter) bool {
+	v, ok := n.o.value(get)
+	if !ok || v == nil {
+		return false
+	}
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	return n.re.MatchString(s) != n.negate
+}
+
+//inNode holds when l equals an element of the literal list or of the array r, or is a substring of the string r
+type inNode struct {
+	l    operand
+	list []operand
+	r    operand
+}
+
+func (n *inNode) eval(get Getter) bool {
+	l, ok := n.l.value(get)
+	if !ok {
+		return false
+	}
+	if n.r != nil {
+		r, ok := n.r.value(get)
+		if !ok {
+			return false
+		}
+		switch t := r.(type) {
+		case []interface{}:
+			for _, e := range t {
+				if equal(l, e) {
+					return true
+				}
+			}
+		case string:
+			s, ok := l.(string)
+			return ok && strings.Contains(t, s)
+		}
+		return false
+	}
+	for _, o := range n.list {
+		if e, ok := o.value(get); ok && equal(l, e) {
+			return true
+		}
+	}
+	return false
+}
+
+type cidrNode struct {
+	o    operand
+	nets []*net.IPNet
+}
+
+func (n *cidrNode) eval(get Getter) bool {
+	v, ok := n.o.value(get)
+	if !ok {
+		return false
+	}
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	for _, nw := range n.nets {
+		if nw.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//number returns v as a float64 when it is a json or go number
+func number(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//numeric is number that also accepts numeric strings, grok captures are often strings
+func numeric(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return number(v)
+}
+
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	_, an := number(a)
+	_, bn := number(b)
+	if an || bn {
+		x, xok := numeric(a)
+		y, yok := numeric(b)
+		return xok && yok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+//compare order numbers numerically and strings lexically
+func compare(a, b interface{}) (int, bool) {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		if x, err := strconv.ParseFloat(as, 64); err == nil {
+			if y, err := strconv.ParseFloat(bs, 64); err == nil {
+				return compareFloat(x, y), true
+			}
+		}
+		return strings.Compare(as, bs), true
+	}
+	x, xok := numeric(a)
+	y, yok := numeric(b)
+	if !xok || !yok {
+		return 0, false
+	}
+	return compareFloat(x, y), true
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
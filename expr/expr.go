@@ -0,0 +1,395 @@
+//Package expr compile and evaluate boolean conditions over json event fields.
+//
+//	type == "http" and http.status_code >= 500
+//	not exists(tags) or "_grokparsefailure" in tags
+//	cidr(http.src_ip.dotted, "10.0.0.0/8", "192.168.0.0/16")
+//	http.method in ["POST", "PUT"] && http.url =~ '^/api/'
+//
+//Strings are double quoted with Go escapes or single quoted without escapes,
+//paths are dotted field names, missing fields never compare equal.
+package expr
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//SyntaxError is returned by Compile for invalid expressions
+type SyntaxError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("expr: %s at offset %d in %q", e.Msg, e.Pos, e.Expr)
+}
+
+//Expr is a compiled condition
+type Expr struct {
+	src  string
+	root node
+}
+
+//Compile parse s into an Expr, regexps and networks are checked too
+func Compile(s string) (*Expr, error) {
+	p := &parser{src: s}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+//MustCompile is like Compile but panics on error
+func MustCompile(s string) *Expr {
+	e, err := Compile(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tIdent
+	tString
+	tNumber
+	tPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	val  interface{}
+	pos  int
+}
+
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true,
+	"exists": true, "cidr": true, "true": true, "false": true, "null": true,
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Expr: p.src, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '@' || c == '$' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '.' || c == '-' || ('0' <= c && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+//lex split the source into tokens
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			p.toks = append(p.toks, token{kind: tIdent, text: s[i:j], pos: i})
+			i = j
+		case isDigit(c) || (c == '-' && i+1 < len(s) && isDigit(s[i+1])):
+			j := i + 1
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				((s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return &SyntaxError{Expr: s, Pos: i, Msg: "invalid number " + s[i:j]}
+			}
+			p.toks = append(p.toks, token{kind: tNumber, text: s[i:j], val: f, pos: i})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return &SyntaxError{Expr: s, Pos: i, Msg: "unterminated string"}
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return &SyntaxError{Expr: s, Pos: i, Msg: "invalid string " + s[i:j+1]}
+			}
+			p.toks = append(p.toks, token{kind: tString, text: s[i : j+1], val: v, pos: i})
+			i = j + 1
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return &SyntaxError{Expr: s, Pos: i, Msg: "unterminated string"}
+			}
+			p.toks = append(p.toks, token{kind: tString, text: s[i : i+j+2], val: s[i+1 : i+j+1], pos: i})
+			i += j + 2
+		default:
+			op := ""
+			if i+1 < len(s) {
+				switch s[i : i+2] {
+				case "==", "!=", "<=", ">=", "=~", "!~", "&&", "||":
+					op = s[i : i+2]
+				}
+			}
+			if len(op) == 0 && strings.IndexByte("()[],<>!", c) >= 0 {
+				op = s[i : i+1]
+			}
+			if len(op) == 0 {
+				return &SyntaxError{Expr: s, Pos: i, Msg: fmt.Sprintf("unexpected %q", c)}
+			}
+			p.toks = append(p.toks, token{kind: tPunct, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, token{kind: tEOF, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tEOF {
+		p.i++
+	}
+	return t
+}
+
+//is reports whether the next token is one of texts, keywords are idents and operators puncts
+func (p *parser) is(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tIdent && t.kind != tPunct {
+		return false
+	}
+	for _, s := range texts {
+		if t.text == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); t.kind != tPunct || t.text != text {
+		return p.errorf(t, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("or", "||") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("and", "&&") {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("not", "!") {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	switch {
+	case p.is("("):
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case p.is("exists"):
+		p.next()
+		paren := p.is("(")
+		if paren {
+			p.next()
+		}
+		t := p.next()
+		if t.kind != tIdent || keywords[t.text] {
+			return nil, p.errorf(t, "exists needs a field path, found %q", t.text)
+		}
+		if paren {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		return &existsNode{splitPath(t.text)}, nil
+	case p.is("cidr"):
+		return p.parseCIDR()
+	}
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case p.is("==", "!=", "<", "<=", ">", ">="):
+		p.next()
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &cmpNode{t.text, l, r}, nil
+	case p.is("=~", "!~"):
+		p.next()
+		rt := p.next()
+		if rt.kind != tString {
+			return nil, p.errorf(rt, "%s needs a string regexp, found %q", t.text, rt.text)
+		}
+		re, err := regexp.Compile(rt.val.(string))
+		if err != nil {
+			return nil, p.errorf(rt, "%s", err.Error())
+		}
+		return &matchNode{l, re, t.text == "!~"}, nil
+	case p.is("in"):
+		p.next()
+		if !p.is("[") {
+			r, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &inNode{l: l, r: r}, nil
+		}
+		p.next()
+		var list []operand
+		for !p.is("]") {
+			e, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, e)
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return &inNode{l: l, list: list}, nil
+	}
+	return &truthNode{l}, nil
+}
+
+//parseCIDR parse cidr(operand, "net", ...)
+func (p *parser) parseCIDR() (node, error) {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	var nets []*net.IPNet
+	for p.is(",") {
+		p.next()
+		t := p.next()
+		if t.kind != tString {
+			return nil, p.errorf(t, "cidr needs string networks, found %q", t.text)
+		}
+		_, n, err := net.ParseCIDR(t.val.(string))
+		if err != nil {
+			return nil, p.errorf(t, "%s", err.Error())
+		}
+		nets = append(nets, n)
+	}
+	if len(nets) == 0 {
+		return nil, p.errorf(p.peek(), "cidr needs at least one network")
+	}
+	return &cidrNode{l, nets}, p.expect(")")
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tString, tNumber:
+		return literal{t.val}, nil
+	case tIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if !keywords[t.text] {
+			return pathOperand(splitPath(t.text)), nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %q", t.text)
+}
+
+func splitPath(s string) []string {
+	return strings.Split(s, ".")
+}
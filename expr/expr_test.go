@@ -0,0 +1,117 @@
+package expr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const doc = `{
+	"type": "http",
+	"tags": ["a", "_grokparsefailure"],
+	"http": {
+		"method": "POST",
+		"url": "/api/v1/users",
+		"status_code": 503,
+		"bytes": "1024",
+		"src_ip": {"dotted": "10.1.2.3"},
+		"dst_ip": "2001:db8::1",
+		"ok": false,
+		"empty": ""
+	},
+	"nothing": null
+}`
+
+func TestEval(t *testing.T) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	get := MapGetter(v)
+
+	var tests = []struct {
+		expr string
+		want bool
+	}{
+		{`type == "http"`, true},
+		{`type == 'dns'`, false},
+		{`type != "dns"`, true},
+		{`missing == "x"`, false},
+		{`missing != "x"`, true},
+		{`nothing == null`, true},
+		{`http.status_code == 503`, true},
+		{`http.status_code >= 500 and http.status_code < 600`, true},
+		{`http.bytes > 1000`, true},
+		{`http.bytes == 1024`, true},
+		{`http.method < "PUT"`, true},
+		{`missing > 1`, false},
+		{`http.method in ["POST", "PUT"]`, true},
+		{`http.method in ["GET"]`, false},
+		{`"_grokparsefailure" in tags`, true},
+		{`"b" in tags`, false},
+		{`"api" in http.url`, true},
+		{`http.url =~ '^/api/v\d+/'`, true},
+		{`http.url !~ "^/api/"`, false},
+		{`missing =~ "x"`, false},
+		{`cidr(http.src_ip.dotted, "192.168.0.0/16", "10.0.0.0/8")`, true},
+		{`cidr(http.src_ip.dotted, "192.168.0.0/16")`, false},
+		{`cidr(http.dst_ip, "2001:db8::/32")`, true},
+		{`cidr(http.src_ip, "10.0.0.0/8")`, false},
+		{`exists(http.src_ip)`, true},
+		{`exists http.missing`, false},
+		{`exists(nothing)`, true},
+		{`http.ok`, false},
+		{`http.empty`, false},
+		{`http.method`, true},
+		{`not http.ok`, true},
+		{`!exists(tags) || type == "http"`, true},
+		{`type == "dns" or type == "http" and http.ok`, false},
+		{`(type == "dns" or type == "http") and not http.ok`, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%s) fail: %s", tt.expr, err.Error())
+			continue
+		}
+		if got := e.Eval(get); got != tt.want {
+			t.Errorf("%s = %v, but we want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalJSON(t *testing.T) {
+	e := MustCompile(`type == "http"`)
+	if !e.EvalJSON([]byte(doc)) {
+		t.Errorf("EvalJSON(doc) = false, but we want true")
+	}
+	if e.EvalJSON([]byte(`{"type":`)) {
+		t.Errorf("EvalJSON of invalid json should be false")
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	var tests = []string{
+		``,
+		`type ==`,
+		`type = "http"`,
+		`type == "http`,
+		`type == 'http`,
+		`(type == "http"`,
+		`type == "http")`,
+		`url =~ "("`,
+		`url =~ url`,
+		`cidr(ip, "10.0.0.0/33")`,
+		`cidr(ip)`,
+		`exists "x"`,
+		`a in [1, 2`,
+		`a and`,
+		`a # b`,
+	}
+	for _, s := range tests {
+		if _, err := Compile(s); err == nil {
+			t.Errorf("Compile(%s) should fail", s)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Compile(%s) error = %T, but we want *SyntaxError", s, err)
+		}
+	}
+}
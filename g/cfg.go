@@ -2,15 +2,18 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/chenyoufu/yfstream/expr"
 	"github.com/toolkits/file"
 	"log"
 	"sync"
 )
 
-//HTTPConfig for debug
+//HTTPConfig for debug, token is the bearer token of the admin endpoints
 type HTTPConfig struct {
 	Enabled bool   `json:"enabled"`
 	Listen  string `json:"listen"`
+	Token   string `json:"token"`
 }
 
 //KafkaConfig for pull
@@ -19,32 +22,164 @@ type KafkaConfig struct {
 	Topics     []string `json:"topics"`
 	Brokers    []string `json:"brokers"`
 	ConsumerID string   `json:"consumerId"`
+	OffsetFile string   `json:"offsetFile"`
 }
 
-//ESConfig for dump
+//NSQPullConfig for pull
+type NSQPullConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Topic       string   `json:"topic"`
+	Channel     string   `json:"channel"`
+	Lookupds    []string `json:"lookupds"`
+	Nsqds       []string `json:"nsqds"`
+	MaxInFlight int      `json:"maxInFlight"`
+	MaxAttempts uint16   `json:"maxAttempts"`
+}
+
+//MongoPullConfig for pull
+type MongoPullConfig struct {
+	Enabled    bool   `json:"enabled"`
+	URL        string `json:"url"`
+	Database   string `json:"database"`
+	Collection string `json:"collection"`
+	Oplog      bool   `json:"oplog"`
+	ResumeFile string `json:"resumeFile"`
+}
+
+//TLSConfig for socket pull and dump
+type TLSConfig struct {
+	Enabled            bool   `json:"enabled"`
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+//SocketPullConfig for pull
+type SocketPullConfig struct {
+	Enabled      bool      `json:"enabled"`
+	Network      string    `json:"network"`
+	Address      string    `json:"address"`
+	Framing      string    `json:"framing"`
+	MaxFrameSize int       `json:"maxFrameSize"`
+	TLS          TLSConfig `json:"tls"`
+}
+
+//ESConfig for dump, indexDefault names the index of events from a source without a topic or namespace
 type ESConfig struct {
-	Enabled     bool   `json:"enabled"`
-	Interval    int64  `json:"interval"`
-	BulkURL     string `json:"bulkUrl"`
-	IndexPrefix string `json:"indexPrefix"`
-	IndexSuffix string `json:"indexSuffix"`
+	Enabled      bool   `json:"enabled"`
+	Interval     int64  `json:"interval"`
+	BulkURL      string `json:"bulkUrl"`
+	IndexPrefix  string `json:"indexPrefix"`
+	IndexSuffix  string `json:"indexSuffix"`
+	IndexDefault string `json:"indexDefault"`
 }
 
 //RedisConfig for dump
 type RedisConfig struct {
-	Enabled bool   `json:"enabled"`
-	Server  string `json:"server"`
+	Enabled   bool   `json:"enabled"`
+	Server    string `json:"server"`
+	Mode      string `json:"mode"`
+	Key       string `json:"key"`
+	Push      string `json:"push"`
+	MaxLen    int64  `json:"maxLen"`
+	TTL       int64  `json:"ttl"`
+	BatchSize int    `json:"batchSize"`
+	Interval  int64  `json:"interval"`
+}
+
+//NSQDumpConfig for dump
+type NSQDumpConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Nsqd      string `json:"nsqd"`
+	Topic     string `json:"topic"`
+	BatchSize int    `json:"batchSize"`
+	Interval  int64  `json:"interval"`
+}
+
+//MongoDumpConfig for dump
+type MongoDumpConfig struct {
+	Enabled    bool   `json:"enabled"`
+	URL        string `json:"url"`
+	Database   string `json:"database"`
+	Collection string `json:"collection"`
+	Ordered    bool   `json:"ordered"`
+	BatchSize  int    `json:"batchSize"`
+	Interval   int64  `json:"interval"`
+}
+
+//KafkaDumpConfig for dump
+type KafkaDumpConfig struct {
+	Enabled         bool     `json:"enabled"`
+	Brokers         []string `json:"brokers"`
+	Topic           string   `json:"topic"`
+	KeyField        string   `json:"keyField"`
+	Partitioner     string   `json:"partitioner"`
+	Compression     string   `json:"compression"`
+	Acks            string   `json:"acks"`
+	Idempotent      bool     `json:"idempotent"`
+	BatchSize       int      `json:"batchSize"`
+	BatchBytes      int      `json:"batchBytes"`
+	FlushMs         int64    `json:"flushMs"`
+	Retries         int      `json:"retries"`
+	DeadLetterTopic string   `json:"deadLetterTopic"`
+	BufferSize      int      `json:"bufferSize"`
+}
+
+//FileDumpConfig for dump
+type FileDumpConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Path        string `json:"path"`
+	MaxSize     int64  `json:"maxSize"`
+	Interval    int64  `json:"interval"`
+	IdleTimeout int64  `json:"idleTimeout"`
+	Compress    bool   `json:"compress"`
+	MaxOpen     int    `json:"maxOpen"`
+}
+
+//StdoutDumpConfig for dump
+type StdoutDumpConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Stderr   bool     `json:"stderr"`
+	Format   string   `json:"format"`
+	Template string   `json:"template"`
+	Sample   int      `json:"sample"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+}
+
+//SocketDumpConfig for dump
+type SocketDumpConfig struct {
+	Enabled      bool      `json:"enabled"`
+	Network      string    `json:"network"`
+	Address      string    `json:"address"`
+	Framing      string    `json:"framing"`
+	BufferSize   int       `json:"bufferSize"`
+	MinBackoffMs int64     `json:"minBackoffMs"`
+	MaxBackoffMs int64     `json:"maxBackoffMs"`
+	TLS          TLSConfig `json:"tls"`
 }
 
 //PullConfig for data source
 type PullConfig struct {
-	Kafka KafkaConfig `json:"kafka"`
+	Kafka  KafkaConfig      `json:"kafka"`
+	NSQ    NSQPullConfig    `json:"nsq"`
+	Mongo  MongoPullConfig  `json:"mongodb"`
+	Socket SocketPullConfig `json:"socket"`
 }
 
-//DumpConfig for data storage
+//DumpConfig for data storage, metadata makes the sinks write the @metadata of events
 type DumpConfig struct {
-	ES    ESConfig    `json:"es"`
-	Redis RedisConfig `json:"redis"`
+	Metadata bool             `json:"metadata"`
+	ES       ESConfig         `json:"es"`
+	Redis    RedisConfig      `json:"redis"`
+	NSQ      NSQDumpConfig    `json:"nsq"`
+	Mongo    MongoDumpConfig  `json:"mongodb"`
+	Kafka    KafkaDumpConfig  `json:"kafka"`
+	File     FileDumpConfig   `json:"file"`
+	Stdout   StdoutDumpConfig `json:"stdout"`
+	Socket   SocketDumpConfig `json:"socket"`
 }
 
 //AlertConfig for alert
@@ -55,13 +190,128 @@ type AlertConfig struct {
 	RedisHost string `json:"redisHost"`
 }
 
+//GrokRule parse a field of the matching events with the first matching pattern
+type GrokRule struct {
+	Types    []string          `json:"types"`
+	Match    map[string]string `json:"match"`
+	Field    string            `json:"field"`
+	Patterns []string          `json:"patterns"`
+	Target   string            `json:"target"`
+	PerfData []string          `json:"perfData"`
+}
+
+//ProcessorConfig is one step of the cook processor chain
+type ProcessorConfig struct {
+	Processor string      `json:"processor"`
+	Types     []string    `json:"types"`
+	If        string      `json:"if"`
+	Field     string      `json:"field"`
+	Fields    []string    `json:"fields"`
+	Target    string      `json:"target"`
+	Value     interface{} `json:"value"`
+	To        string      `json:"to"`
+	Separator string      `json:"separator"`
+	Formats   []string    `json:"formats"`
+	Timezone  string      `json:"timezone"`
+
+	Dictionary     string `json:"dictionary"`
+	ReloadInterval int64  `json:"reloadInterval"`
+	Resolver       string `json:"resolver"`
+	Timeout        int64  `json:"timeout"`
+	CacheSize      int    `json:"cacheSize"`
+	CacheTTL       int64  `json:"cacheTTL"`
+	NegativeTTL    int64  `json:"negativeTTL"`
+}
+
+//EnrichRule enrich the values at fields, or at target when it is set
+type EnrichRule struct {
+	Types     []string `json:"types"`
+	Fields    []string `json:"fields"`
+	Target    string   `json:"target"`
+	Enrichers []string `json:"enrichers"`
+}
+
+//IPDBConfig select the ip database of cook, backend is qqzeng or mmdb.
+//typedRecord gives the qqzeng records the float coordinates and province region of mmdb.
+type IPDBConfig struct {
+	Backend        string `json:"backend"`
+	File           string `json:"file"`
+	IPv6File       string `json:"ipv6File"`
+	Language       string `json:"language"`
+	ReloadInterval int64  `json:"reloadInterval"`
+	TypedRecord    bool   `json:"typedRecord"`
+}
+
+//ASNConfig select the asn database of cook, backend is csv or mmdb
+type ASNConfig struct {
+	Backend string `json:"backend"`
+	File    string `json:"file"`
+}
+
+//NetworksConfig map internal ranges to attributes such as site or owner, from a cidr csv file and inline
+type NetworksConfig struct {
+	File  string                       `json:"file"`
+	CIDRs map[string]map[string]string `json:"cidrs"`
+}
+
+//ThreatFeed is an indicator file, format is list, csv or stix
+type ThreatFeed struct {
+	Name     string `json:"name"`
+	File     string `json:"file"`
+	Format   string `json:"format"`
+	Severity string `json:"severity"`
+}
+
+//ThreatConfig match the ips, domains and url hosts at fields against the indicators of feeds
+type ThreatConfig struct {
+	Feeds          []ThreatFeed `json:"feeds"`
+	Fields         []string     `json:"fields"`
+	ReloadInterval int64        `json:"reloadInterval"`
+}
+
+//UserAgentConfig of the ua enricher, crawlers is a json or yaml list of {regex, name} replacing the built-in crawler list
+type UserAgentConfig struct {
+	Crawlers string `json:"crawlers"`
+}
+
+//ECSConfig turn on the normalisation of cooked events to the elastic common schema,
+//keepLegacy keeps the fields the common ones are made from
+type ECSConfig struct {
+	Enabled    bool `json:"enabled"`
+	KeepLegacy bool `json:"keepLegacy"`
+}
+
+//CacheConfig of an enrichment cache, a size of 0 disables it and ttl is in seconds
+type CacheConfig struct {
+	Size int   `json:"size"`
+	TTL  int64 `json:"ttl"`
+}
+
+//CookConfig for cook
+type CookConfig struct {
+	PatternsDir string            `json:"patternsDir"`
+	IPDB        IPDBConfig        `json:"ipdb"`
+	ASN         ASNConfig         `json:"asn"`
+	Networks    NetworksConfig    `json:"networks"`
+	IPCache     CacheConfig       `json:"ipCache"`
+	UACache     CacheConfig       `json:"uaCache"`
+	Threat      ThreatConfig      `json:"threat"`
+	UserAgent   UserAgentConfig   `json:"userAgent"`
+	ECS         ECSConfig         `json:"ecs"`
+	Grok        []GrokRule        `json:"grok"`
+	Processors  []ProcessorConfig `json:"processors"`
+	Enrich      []EnrichRule      `json:"enrich"`
+}
+
 //GlobalConfig ...
 type GlobalConfig struct {
-	Debug bool         `json:"debug"`
-	HTTP  *HTTPConfig  `json:"http"`
-	Pull  *PullConfig  `json:"pull"`
-	Dump  *DumpConfig  `json:"dump"`
-	Alert *AlertConfig `json:"alert"`
+	Debug  bool              `json:"debug"`
+	HTTP   *HTTPConfig       `json:"http"`
+	Pull   *PullConfig       `json:"pull"`
+	Dump   *DumpConfig       `json:"dump"`
+	Alert  *AlertConfig      `json:"alert"`
+	Cook   *CookConfig       `json:"cook"`
+	Routes map[string]string `json:"routes"`
 }
 
 var (
@@ -86,6 +336,26 @@ func (c *GlobalConfig) String() string {
 	return string(s)
 }
 
+//validate compile every condition of the config
+func (c *GlobalConfig) validate() error {
+	for name, when := range c.Routes {
+		if _, err := expr.Compile(when); err != nil {
+			return fmt.Errorf("route %s: %s", name, err.Error())
+		}
+	}
+	if c.Cook != nil {
+		for i, p := range c.Cook.Processors {
+			if len(p.If) == 0 {
+				continue
+			}
+			if _, err := expr.Compile(p.If); err != nil {
+				return fmt.Errorf("processor %d (%s): %s", i, p.Processor, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
 //ParseConfig init the global config file
 func ParseConfig(cfg string) {
 	if cfg == "" {
@@ -107,6 +377,10 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
 
+	if err := c.validate(); err != nil {
+		log.Fatalln("parse config file:", cfg, "fail:", err)
+	}
+
 	configLock.Lock()
 	defer configLock.Unlock()
 
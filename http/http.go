@@ -0,0 +1,98 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/chenyoufu/yfstream/cook"
+	"github.com/chenyoufu/yfstream/g"
+)
+
+// replaced by tests
+var (
+	reloadIPDB   = cook.ReloadIPDB
+	reloadThreat = cook.ReloadThreat
+	cacheStats   = cook.CacheStats
+)
+
+func renderJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func renderError(w http.ResponseWriter, code int, err string) {
+	renderJSON(w, code, map[string]string{"error": err})
+}
+
+//reloadHandler run reload on POST
+func reloadHandler(reload func() error, msg string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			renderError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		if err := reload(); err != nil {
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		renderJSON(w, http.StatusOK, map[string]string{"msg": msg})
+	}
+}
+
+//fromLoopback reports whether the request comes from the host itself
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//adminHandler guard h, with a token the request must carry it as a bearer token,
+//without one it must come from the host itself
+func adminHandler(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(token) > 0 {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+				renderError(w, http.StatusUnauthorized, "a valid token is required")
+				return
+			}
+		} else if !fromLoopback(r) {
+			renderError(w, http.StatusForbidden, "set http.token to allow remote requests")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func routes(mux *http.ServeMux, token string) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(g.VERSION))
+	})
+	mux.HandleFunc("/ipdb/reload", adminHandler(token, reloadHandler(func() error { return reloadIPDB() }, "ip database reloaded")))
+	mux.HandleFunc("/threat/reload", adminHandler(token, reloadHandler(func() error { return reloadThreat() }, "threat feeds reloaded")))
+	mux.HandleFunc("/cook/cache", adminHandler(token, func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, http.StatusOK, cacheStats())
+	}))
+}
+
+//Start serve the admin endpoints when http is enabled, they need the token of the config
+//or a local request
+func Start() {
+	cfg := g.Config().HTTP
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+	mux := http.NewServeMux()
+	routes(mux, cfg.Token)
+	log.Println("http listening", cfg.Listen)
+	log.Fatalln(http.ListenAndServe(cfg.Listen, mux))
+}
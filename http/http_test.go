@@ -0,0 +1,113 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chenyoufu/yfstream/lru"
+)
+
+func localRequest(method, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = "127.0.0.1:41234"
+	return r
+}
+
+func TestAdminAuth(t *testing.T) {
+	reloadIPDB = func() error { return nil }
+	var tests = []struct {
+		token  string
+		remote string
+		auth   string
+		code   int
+	}{
+		{"", "127.0.0.1:41234", "", http.StatusOK},
+		{"", "[::1]:41234", "", http.StatusOK},
+		{"", "10.0.0.8:41234", "", http.StatusForbidden},
+		{"s3cret", "10.0.0.8:41234", "Bearer s3cret", http.StatusOK},
+		{"s3cret", "10.0.0.8:41234", "Bearer nope", http.StatusUnauthorized},
+		{"s3cret", "127.0.0.1:41234", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		mux := http.NewServeMux()
+		routes(mux, tt.token)
+		for _, path := range []string{"/ipdb/reload", "/cook/cache"} {
+			r := httptest.NewRequest("POST", path, nil)
+			r.RemoteAddr = tt.remote
+			if len(tt.auth) > 0 {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("POST %s from %s with token %q and %q = %d, but we want %d", path, tt.remote, tt.token, tt.auth, w.Code, tt.code)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	routes(mux, "s3cret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /health = %d, but we want it open", w.Code)
+	}
+}
+
+func TestReloadIPDB(t *testing.T) {
+	var fail error
+	calls := 0
+	reloadIPDB = func() error {
+		calls++
+		return fail
+	}
+	mux := http.NewServeMux()
+	routes(mux, "")
+
+	var tests = []struct {
+		method string
+		fail   error
+		code   int
+		body   string
+	}{
+		{"GET", nil, http.StatusMethodNotAllowed, "use POST"},
+		{"POST", nil, http.StatusOK, "reloaded"},
+		{"POST", errors.New("ip dat too short"), http.StatusInternalServerError, "ip dat too short"},
+	}
+	for _, tt := range tests {
+		fail = tt.fail
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, localRequest(tt.method, "/ipdb/reload"))
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s /ipdb/reload = %d %s, but we want %d %s", tt.method, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("reloadIPDB called %d times, but we want 2", calls)
+	}
+
+	reloadThreat = func() error { return errors.New("no threat feed is configured") }
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, localRequest("POST", "/threat/reload"))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "no threat feed") {
+		t.Errorf("POST /threat/reload = %d %s, but we want 500 no threat feed", w.Code, w.Body.String())
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	cacheStats = func() map[string]lru.Stats {
+		return map[string]lru.Stats{"ip": {Size: 10, Len: 1, Hits: 3, Misses: 1, HitRate: 0.75}}
+	}
+	mux := http.NewServeMux()
+	routes(mux, "")
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, localRequest("GET", "/cook/cache"))
+	want := `{"ip":{"size":10,"len":1,"hits":3,"misses":1,"evictions":0,"hitRate":0.75}}`
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+		t.Errorf("GET /cook/cache = %d %s, but we want 200 %s", w.Code, w.Body.String(), want)
+	}
+}
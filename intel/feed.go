@@ -0,0 +1,159 @@
+package intel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//Feed is an indicator file, format is list, csv or stix.
+//Name is the source of its indicators and Severity their default severity.
+type Feed struct {
+	Name     string
+	File     string
+	Format   string
+	Severity string
+}
+
+//LoadFeeds read every feed into a new Set
+func LoadFeeds(feeds []Feed) (*Set, error) {
+	s := NewSet()
+	for _, f := range feeds {
+		if err := f.load(s); err != nil {
+			return nil, fmt.Errorf("threat feed %s: %s", f.Name, err.Error())
+		}
+	}
+	return s, nil
+}
+
+func (f Feed) load(s *Set) error {
+	r, err := os.Open(f.File)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return Load(r, f, s)
+}
+
+//Load read the indicators of feed from r into s
+func Load(r io.Reader, feed Feed, s *Set) error {
+	switch feed.Format {
+	case "", "list":
+		return loadList(r, feed, s)
+	case "csv":
+		return loadCSV(r, feed, s)
+	case "stix":
+		return loadSTIX(r, feed, s)
+	}
+	return fmt.Errorf("unknown format %q", feed.Format)
+}
+
+//loadList read one indicator per line, what follows the first field is a comment
+func loadList(r io.Reader, feed Feed, s *Set) error {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0][0] == '#' || fields[0][0] == ';' {
+			continue
+		}
+		if !s.Add(Indicator{Value: fields[0], Source: feed.Name, Severity: feed.Severity}) {
+			return fmt.Errorf("line %d: invalid indicator %q", line, fields[0])
+		}
+	}
+	return sc.Err()
+}
+
+//loadCSV read a csv with an indicator column and optional type, source and severity columns
+func loadCSV(r io.Reader, feed Feed, s *Set) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("csv header: %s", err.Error())
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	col, ok := cols["indicator"]
+	if !ok {
+		return fmt.Errorf("csv header %v has no indicator column", header)
+	}
+	get := func(row []string, name, def string) string {
+		if i, ok := cols[name]; ok && len(strings.TrimSpace(row[i])) > 0 {
+			return strings.TrimSpace(row[i])
+		}
+		return def
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ind := Indicator{
+			Value:    row[col],
+			Type:     get(row, "type", ""),
+			Source:   get(row, "source", feed.Name),
+			Severity: get(row, "severity", feed.Severity),
+		}
+		if !s.Add(ind) {
+			line, _ := cr.FieldPos(col)
+			return fmt.Errorf("line %d: invalid indicator %q", line, row[col])
+		}
+	}
+}
+
+// the comparisons of a stix pattern we can match
+var stixComparison = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name|url):value\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+var stixTypes = map[string]string{"ipv4-addr": "", "ipv6-addr": "", "domain-name": "domain", "url": "url"}
+
+type stixObject struct {
+	Type     string `json:"type"`
+	Pattern  string `json:"pattern"`
+	Revoked  bool   `json:"revoked"`
+	Severity string `json:"x_severity"`
+}
+
+//loadSTIX read the indicators of a stix 2 bundle, or of a bare array of objects.
+//Each ip, domain and url comparison of a pattern is an indicator, other objects are skipped.
+func loadSTIX(r io.Reader, feed Feed, s *Set) error {
+	var bundle struct {
+		Objects []stixObject `json:"objects"`
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		if err := json.Unmarshal(data, &bundle.Objects); err != nil {
+			return err
+		}
+	}
+	for i, o := range bundle.Objects {
+		if o.Type != "indicator" || o.Revoked {
+			continue
+		}
+		severity := feed.Severity
+		if len(o.Severity) > 0 {
+			severity = o.Severity
+		}
+		for _, m := range stixComparison.FindAllStringSubmatch(o.Pattern, -1) {
+			v := strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(m[2])
+			if !s.Add(Indicator{Value: v, Type: stixTypes[m[1]], Source: feed.Name, Severity: severity}) {
+				return fmt.Errorf("object %d: invalid indicator %q", i, v)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package intel
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/chenyoufu/yfstream/ipsearch"
+)
+
+//Indicator is an ip, network or domain of a feed
+type Indicator struct {
+	Value    string `json:"indicator"`
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+// severities in increasing order, unknown ones rank below low
+var severities = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+//Rank returns the order of a severity, higher is worse
+func Rank(severity string) int {
+	return severities[strings.ToLower(severity)]
+}
+
+//Set holds the indicators of every feed, ips and networks are matched
+//by longest prefix and domains match their subdomains too
+type Set struct {
+	nets    *ipsearch.CIDRTable
+	domains map[string]*Indicator
+}
+
+//NewSet returns an empty Set
+func NewSet() *Set {
+	return &Set{
+		nets:    ipsearch.NewCIDRTable(),
+		domains: make(map[string]*Indicator),
+	}
+}
+
+//Add insert an indicator, its type is guessed when empty. An indicator
+//already in the set is replaced when the new one is more severe.
+func (s *Set) Add(ind Indicator) bool {
+	v := strings.ToLower(strings.TrimSpace(ind.Value))
+	if ind.Type == "" || ind.Type == "url" {
+		ind.Type = guessType(v)
+	}
+	switch ind.Type {
+	case "ip", "cidr":
+		var n *net.IPNet
+		if isCIDR(v) {
+			_, n, _ = net.ParseCIDR(v)
+		} else if ind.Type == "cidr" || badCIDR(v) {
+			return reject(ind, "not a network")
+		} else {
+			ip := net.ParseIP(Host(v))
+			if ip == nil {
+				return reject(ind, "not an ip")
+			}
+			v = ip.String()
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			n = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		if prev, ok := s.nets.Get(n.String()); ok && Rank(prev.Attrs["severity"]) >= Rank(ind.Severity) {
+			return true
+		}
+		ind.Value = v
+		s.nets.Add(n.String(), map[string]string{
+			"indicator": ind.Value,
+			"type":      ind.Type,
+			"source":    ind.Source,
+			"severity":  ind.Severity,
+		})
+	case "domain":
+		if isCIDR(v) {
+			return reject(ind, "a network is not a domain")
+		}
+		v = Host(v)
+		if !validDomain(v) {
+			return reject(ind, "not a domain")
+		}
+		if prev, ok := s.domains[v]; ok && Rank(prev.Severity) >= Rank(ind.Severity) {
+			return true
+		}
+		ind.Value = v
+		s.domains[v] = &ind
+	default:
+		return reject(ind, "unknown type")
+	}
+	return true
+}
+
+//reject log why ind is not added and returns false
+func reject(ind Indicator, reason string) bool {
+	log.Printf("Drop %s indicator %q from %s: %s", ind.Type, ind.Value, ind.Source, reason)
+	return false
+}
+
+//Len returns the number of indicators
+func (s *Set) Len() int {
+	return s.nets.Len() + len(s.domains)
+}
+
+//MatchIP returns the indicator of the longest network holding ip
+func (s *Set) MatchIP(ip net.IP) (*Indicator, bool) {
+	n, ok := s.nets.Lookup(ip)
+	if !ok {
+		return nil, false
+	}
+	return &Indicator{
+		Value:    n.Attrs["indicator"],
+		Type:     n.Attrs["type"],
+		Source:   n.Attrs["source"],
+		Severity: n.Attrs["severity"],
+	}, true
+}
+
+//MatchDomain returns the indicator of host or of its closest listed parent domain
+func (s *Set) MatchDomain(host string) (*Indicator, bool) {
+	host = Host(host)
+	for len(host) > 0 {
+		if ind, ok := s.domains[host]; ok {
+			return ind, true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return nil, false
+}
+
+//Match an ip, a domain or the host of an url
+func (s *Set) Match(v string) (*Indicator, bool) {
+	v = strings.TrimSpace(v)
+	if ip := net.ParseIP(v); ip != nil {
+		return s.MatchIP(ip)
+	}
+	h := Host(v)
+	if ip := net.ParseIP(h); ip != nil {
+		return s.MatchIP(ip)
+	}
+	return s.MatchDomain(h)
+}
+
+//Host returns the lowercase host of an url, a host:port or a domain
+func Host(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if i := strings.Index(v, "://"); i >= 0 {
+		v = v[i+3:]
+	}
+	if i := strings.IndexAny(v, "/?#"); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.LastIndexByte(v, '@'); i >= 0 {
+		v = v[i+1:]
+	}
+	if strings.HasPrefix(v, "[") {
+		if i := strings.IndexByte(v, ']'); i > 0 {
+			return v[1:i]
+		}
+	}
+	if h, _, err := net.SplitHostPort(v); err == nil {
+		v = h
+	}
+	return strings.TrimSuffix(v, ".")
+}
+
+// isCIDR reports whether v is a network in CIDR notation
+func isCIDR(v string) bool {
+	_, _, err := net.ParseCIDR(v)
+	return err == nil
+}
+
+// badCIDR reports whether v is an address and a prefix length that don't make a network,
+// like 1.2.3.4/40, rather than a host and an url path
+func badCIDR(v string) bool {
+	i := strings.IndexByte(v, '/')
+	if i < 0 || net.ParseIP(v[:i]) == nil {
+		return false
+	}
+	_, err := strconv.Atoi(v[i+1:])
+	return err == nil && !isCIDR(v)
+}
+
+func validDomain(v string) bool {
+	if len(v) == 0 || strings.Contains(v, "..") {
+		return false
+	}
+	for _, r := range v {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func guessType(v string) string {
+	if net.ParseIP(v) != nil {
+		return "ip"
+	}
+	if isCIDR(v) {
+		return "cidr"
+	}
+	if ip := net.ParseIP(Host(v)); ip != nil {
+		return "ip"
+	}
+	return "domain"
+}
@@ -0,0 +1,195 @@
+package intel
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHost(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"Evil.COM", "evil.com"},
+		{"evil.com.", "evil.com"},
+		{"http://user@www.evil.com:8080/a/b?c#d", "www.evil.com"},
+		{"evil.com:443", "evil.com"},
+		{"https://[2001:db8::1]:443/x", "2001:db8::1"},
+		{"1.2.3.4:80", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		if got := Host(tt.input); got != tt.want {
+			t.Errorf("Host(%q) = %v, but we want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	s := NewSet()
+	for _, ind := range []Indicator{
+		{Value: "1.2.3.4", Source: "a", Severity: "high"},
+		{Value: "1.2.3.0/24", Source: "b", Severity: "low"},
+		{Value: "2001:db8::/32", Source: "b", Severity: "medium"},
+		{Value: "evil.com", Source: "a", Severity: "medium"},
+		{Value: "http://bad.example.org/payload.exe", Type: "url", Source: "c", Severity: "critical"},
+		// urls without scheme are added on their host
+		{Value: "malware.test/drop/x.exe", Source: "e", Severity: "high"},
+		{Value: "5.6.7.9/admin", Source: "e", Severity: "high"},
+		// a less severe duplicate keeps the first one
+		{Value: "EVIL.com", Source: "d", Severity: "low"},
+		{Value: "1.2.3.4", Source: "d", Severity: "low"},
+	} {
+		if !s.Add(ind) {
+			t.Errorf("Add(%v) fail", ind)
+		}
+	}
+	for _, ind := range []Indicator{
+		{Value: "1.2.3.4/40"},
+		{Value: "evil.com/path", Type: "cidr"},
+		{Value: "", Type: "domain"},
+		{Value: "x", Type: "hash"},
+	} {
+		if s.Add(ind) {
+			t.Errorf("Add(%v) should refuse an invalid indicator", ind)
+		}
+	}
+	if s.Len() != 7 {
+		t.Errorf("Len() = %d, but we want 7", s.Len())
+	}
+
+	var tests = []struct {
+		input     string
+		indicator string
+		source    string
+	}{
+		{"1.2.3.4", "1.2.3.4", "a"},
+		{"1.2.3.5", "1.2.3.0/24", "b"},
+		{"2001:db8::99", "2001:db8::/32", "b"},
+		{"evil.com", "evil.com", "a"},
+		{"cdn.static.evil.com", "evil.com", "a"},
+		{"https://www.evil.com/login", "evil.com", "a"},
+		{"bad.example.org", "bad.example.org", "c"},
+		{"http://1.2.3.4:8080/", "1.2.3.4", "a"},
+		{"www.malware.test", "malware.test", "e"},
+		{"5.6.7.9", "5.6.7.9", "e"},
+		{"notevil.com", "", ""},
+		{"example.org", "", ""},
+		{"5.6.7.8", "", ""},
+	}
+	for _, tt := range tests {
+		ind, ok := s.Match(tt.input)
+		if !ok {
+			if len(tt.indicator) > 0 {
+				t.Errorf("Match(%s) found nothing, but we want %s", tt.input, tt.indicator)
+			}
+			continue
+		}
+		if ind.Value != tt.indicator || ind.Source != tt.source {
+			t.Errorf("Match(%s) = %+v, but we want %s from %s", tt.input, ind, tt.indicator, tt.source)
+		}
+	}
+}
+
+const stixBundle = `{
+  "type": "bundle",
+  "objects": [
+    {"type": "identity", "name": "feed"},
+    {"type": "indicator", "pattern": "[ipv4-addr:value = '198.51.100.7'] OR [domain-name:value = 'c2.example.net']", "x_severity": "critical"},
+    {"type": "indicator", "pattern": "[url:value = 'http://drop.example.com/x\\'y']"},
+    {"type": "indicator", "pattern": "[file:hashes.MD5 = 'd41d8cd98f00b204e9800998ecf8427e']"},
+    {"type": "indicator", "pattern": "[ipv4-addr:value = '192.0.2.1']", "revoked": true}
+  ]
+}`
+
+func TestLoad(t *testing.T) {
+	var tests = []struct {
+		format string
+		input  string
+		match  map[string]string
+	}{
+		{"list", "# comment\n; another\n\n198.51.100.0/24 ; SBL1\nevil.com\n", map[string]string{"198.51.100.9": "medium", "www.evil.com": "medium"}},
+		{"csv", "indicator,type,severity\n198.51.100.7,ip,high\nevil.com,,\n", map[string]string{"198.51.100.7": "high", "evil.com": "medium"}},
+		{"stix", stixBundle, map[string]string{"198.51.100.7": "critical", "c2.example.net": "critical", "drop.example.com": "medium", "192.0.2.1": ""}},
+		{"stix", `[{"type": "indicator", "pattern": "[ipv6-addr:value = '2001:db8::1']"}]`, map[string]string{"2001:db8::1": "medium"}},
+	}
+	for _, tt := range tests {
+		s := NewSet()
+		if err := Load(strings.NewReader(tt.input), Feed{Name: "test", Format: tt.format, Severity: "medium"}, s); err != nil {
+			t.Errorf("Load(%s) fail: %s", tt.format, err.Error())
+			continue
+		}
+		for v, severity := range tt.match {
+			ind, ok := s.Match(v)
+			if len(severity) == 0 {
+				if ok {
+					t.Errorf("Load(%s) Match(%s) = %+v, but we want nothing", tt.format, v, ind)
+				}
+				continue
+			}
+			if !ok || ind.Severity != severity || ind.Source != "test" {
+				t.Errorf("Load(%s) Match(%s) = %+v, but we want severity %s from test", tt.format, v, ind, severity)
+			}
+		}
+	}
+
+	for _, tt := range []struct{ format, input string }{
+		{"list", "1.2.3.4/99\n"},
+		{"csv", "ip,severity\n1.2.3.4,high\n"},
+		{"stix", "{"},
+		{"yaml", ""},
+	} {
+		if err := Load(strings.NewReader(tt.input), Feed{Format: tt.format}, NewSet()); err == nil {
+			t.Errorf("Load(%s, %q) should fail", tt.format, tt.input)
+		}
+	}
+}
+
+func TestFeedsReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "intel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "block.txt")
+	if err := ioutil.WriteFile(file, []byte("evil.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFeeds([]Feed{{Name: "block", File: file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go f.Watch(10*time.Millisecond, stop)
+
+	// a broken file keeps the current indicators
+	ioutil.WriteFile(file, []byte("1.2.3.4/99\n"), 0644)
+	os.Chtimes(file, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	if err := f.Reload(); err == nil {
+		t.Errorf("Reload of a broken feed should fail")
+	}
+	if _, ok := f.Set().Match("evil.com"); !ok {
+		t.Errorf("evil.com should still match after a failed reload")
+	}
+
+	ioutil.WriteFile(file, []byte("bad.org\n"), 0644)
+	os.Chtimes(file, time.Now().Add(2*time.Second), time.Now().Add(2*time.Second))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := f.Set().Match("bad.org"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not reload the changed feed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := f.Set().Match("evil.com"); ok {
+		t.Errorf("evil.com should be gone after the reload")
+	}
+}
@@ -0,0 +1,91 @@
+package intel
+
+import (
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Feeds is the Set of a list of feeds, it is swapped atomically on reload
+type Feeds struct {
+	feeds   []Feed
+	current atomic.Value
+
+	mu     sync.Mutex
+	mtimes []time.Time
+}
+
+//NewFeeds load every feed
+func NewFeeds(feeds []Feed) (*Feeds, error) {
+	f := &Feeds{feeds: feeds}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+//Set returns the current indicators
+func (f *Feeds) Set() *Set {
+	return f.current.Load().(*Set)
+}
+
+func (f *Feeds) stat() []time.Time {
+	mtimes := make([]time.Time, len(f.feeds))
+	for i, feed := range f.feeds {
+		if fi, err := os.Stat(feed.File); err == nil {
+			mtimes[i] = fi.ModTime()
+		}
+	}
+	return mtimes
+}
+
+//Reload read every feed again, the current indicators are kept when one fails
+func (f *Feeds) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	mtimes := f.stat()
+	s, err := LoadFeeds(f.feeds)
+	if err != nil {
+		return err
+	}
+	f.current.Store(s)
+	f.mtimes = mtimes
+	return nil
+}
+
+func (f *Feeds) changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, mt := range f.stat() {
+		if !mt.Equal(f.mtimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+//Watch reload the feeds every interval one of their files changed, until stop is closed
+func (f *Feeds) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !f.changed() {
+				continue
+			}
+			if err := f.Reload(); err != nil {
+				log.Printf("Keep the current threat indicators, reload fail: %s", err.Error())
+				f.mu.Lock()
+				f.mtimes = f.stat()
+				f.mu.Unlock()
+				continue
+			}
+			log.Printf("Reload %d threat indicators done ...", f.Set().Len())
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package ipsearch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASN is the autonomous system announcing an address
+type ASN struct {
+	Number uint32
+	Org    string
+}
+
+// ASNLookup find the autonomous system of an ip address
+type ASNLookup interface {
+	LookupASN(ip net.IP) (asn ASN, ok bool)
+}
+
+type asnRange4 struct {
+	start, end uint32
+	asn        ASN
+}
+
+type asnRange6 struct {
+	start, end net.IP
+	asn        ASN
+}
+
+// ASNTable search prefix to asn ranges. Like IPSearch, ipv4 ranges are
+// indexed by their first octet and the index is binary searched.
+type ASNTable struct {
+	v4     []asnRange4
+	prefix [257]int
+	v6     []asnRange6
+}
+
+// parseASN accept 15169 and AS15169
+func parseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint32(n), err
+}
+
+// lastIP returns the broadcast address of n
+func lastIP(n *net.IPNet) net.IP {
+	ip := make(net.IP, len(n.IP))
+	for i := range n.IP {
+		ip[i] = n.IP[i] | ^n.Mask[i]
+	}
+	return ip
+}
+
+// LoadASNCSV read "network,asn,org" lines, the layout of the GeoLite2 ASN blocks csv.
+// A header line starting with network and # comments are skipped, overlapping networks are an error.
+func LoadASNCSV(r io.Reader) (*ASNTable, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	t := &ASNTable{}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if line == 1 && strings.TrimSpace(row[0]) == "network" {
+			continue
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("line %d: want network,asn,org", line)
+		}
+		_, n, err := net.ParseCIDR(strings.TrimSpace(row[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		number, err := parseASN(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid asn %q", line, row[1])
+		}
+		asn := ASN{Number: number}
+		if len(row) > 2 {
+			asn.Org = strings.TrimSpace(row[2])
+		}
+		if start, ok := IPToUint32(n.IP); ok && len(n.Mask) == net.IPv4len {
+			end, _ := IPToUint32(lastIP(n))
+			t.v4 = append(t.v4, asnRange4{start, end, asn})
+		} else {
+			t.v6 = append(t.v6, asnRange6{n.IP.To16(), lastIP(n).To16(), asn})
+		}
+	}
+	if err := t.index(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewASNFile load an asn csv file
+func NewASNFile(file string) (*ASNTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := LoadASNCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return t, nil
+}
+
+// index sort the ranges and build the first octet index
+func (t *ASNTable) index() error {
+	sort.Slice(t.v4, func(i, j int) bool { return t.v4[i].start < t.v4[j].start })
+	for i := 1; i < len(t.v4); i++ {
+		if t.v4[i].start <= t.v4[i-1].end {
+			return fmt.Errorf("network %s overlaps %s", LongToIp(t.v4[i].start), LongToIp(t.v4[i-1].start))
+		}
+	}
+	sort.Slice(t.v6, func(i, j int) bool { return bytes.Compare(t.v6[i].start, t.v6[j].start) < 0 })
+	for i := 1; i < len(t.v6); i++ {
+		if bytes.Compare(t.v6[i].start, t.v6[i-1].end) <= 0 {
+			return fmt.Errorf("network %s overlaps %s", t.v6[i].start, t.v6[i-1].start)
+		}
+	}
+	// prefix[p] is the first range ending in or after the octet p
+	for p := 0; p < 256; p++ {
+		low := uint32(p) << 24
+		t.prefix[p] = sort.Search(len(t.v4), func(i int) bool { return t.v4[i].end >= low })
+	}
+	t.prefix[256] = len(t.v4)
+	return nil
+}
+
+// LookupASN implements ASNLookup
+func (t *ASNTable) LookupASN(ip net.IP) (ASN, bool) {
+	if n, ok := IPToUint32(ip); ok {
+		// a range ending after the octet may still start in it
+		low, high := t.prefix[n>>24], t.prefix[n>>24+1]+1
+		if high > len(t.v4) {
+			high = len(t.v4)
+		}
+		i := low + sort.Search(high-low, func(i int) bool { return t.v4[low+i].end >= n })
+		if i < high && t.v4[i].start <= n {
+			return t.v4[i].asn, true
+		}
+		return ASN{}, false
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return ASN{}, false
+	}
+	i := sort.Search(len(t.v6), func(i int) bool { return bytes.Compare(t.v6[i].end, ip16) >= 0 })
+	if i < len(t.v6) && bytes.Compare(t.v6[i].start, ip16) <= 0 {
+		return t.v6[i].asn, true
+	}
+	return ASN{}, false
+}
+
+// Len returns the number of ranges
+func (t *ASNTable) Len() int {
+	return len(t.v4) + len(t.v6)
+}
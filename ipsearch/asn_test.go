@@ -0,0 +1,63 @@
+package ipsearch
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const asnCSV = `network,autonomous_system_number,autonomous_system_organization
+8.8.8.0/24,15169,Google LLC
+1.0.0.0/24,AS13335,"Cloudflare, Inc."
+# a /7 spans two first octets
+2.0.0.0/7,3215,Orange
+210.51.0.0/16,4837,CHINA UNICOM China169 Backbone
+2001:4860::/32,15169,Google LLC
+`
+
+func TestASNTable(t *testing.T) {
+	table, err := LoadASNCSV(strings.NewReader(asnCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 5 {
+		t.Errorf("Len() = %d, but we want 5", table.Len())
+	}
+	var tests = []struct {
+		input string
+		want  ASN
+		ok    bool
+	}{
+		{"8.8.8.8", ASN{15169, "Google LLC"}, true},
+		{"8.8.9.8", ASN{}, false},
+		{"1.0.0.1", ASN{13335, "Cloudflare, Inc."}, true},
+		{"2.0.0.1", ASN{3215, "Orange"}, true},
+		{"3.255.255.255", ASN{3215, "Orange"}, true},
+		{"4.0.0.0", ASN{}, false},
+		{"210.51.200.123", ASN{4837, "CHINA UNICOM China169 Backbone"}, true},
+		{"255.255.255.255", ASN{}, false},
+		{"2001:4860:4860::8888", ASN{15169, "Google LLC"}, true},
+		{"2001:4861::1", ASN{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.LookupASN(net.ParseIP(tt.input))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("LookupASN(%s) = %v %v, but we want %v %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoadASNCSVInvalid(t *testing.T) {
+	var tests = []string{
+		"8.8.8.8,15169,Google\n",
+		"8.8.8.0/24,google,Google\n",
+		"8.8.8.0/24\n",
+		"8.8.0.0/16,15169,Google\n8.8.8.0/24,15169,Google\n",
+		"2001:4860::/32,15169,Google\n2001:4860:1::/48,1,x\n",
+	}
+	for _, input := range tests {
+		if _, err := LoadASNCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("LoadASNCSV(%q) should fail", input)
+		}
+	}
+}
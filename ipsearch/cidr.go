@@ -0,0 +1,207 @@
+package ipsearch
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Network is a range of a CIDRTable with its attributes
+type Network struct {
+	Net   *net.IPNet
+	Attrs map[string]string
+}
+
+// cidrLevel holds the networks of one prefix length, keyed by their masked 16 bytes address
+type cidrLevel struct {
+	bits int
+	nets map[[16]byte]*Network
+}
+
+// CIDRTable find the longest prefix holding an address, a lookup costs
+// one map access per distinct prefix length of the table
+type CIDRTable struct {
+	v4, v6 []cidrLevel
+}
+
+// NewCIDRTable returns an empty table
+func NewCIDRTable() *CIDRTable {
+	return &CIDRTable{}
+}
+
+// key mask ip16 to bits
+func key(ip16 net.IP, bits int) [16]byte {
+	var k [16]byte
+	copy(k[:], ip16)
+	for i := range k {
+		switch {
+		case bits >= 8:
+			bits -= 8
+		case bits > 0:
+			k[i] &= ^byte(0xff >> uint(bits))
+			bits = 0
+		default:
+			k[i] = 0
+		}
+	}
+	return k
+}
+
+// Add insert cidr, a network added twice keeps the last attributes
+func (t *CIDRTable) Add(cidr string, attrs map[string]string) error {
+	_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return err
+	}
+	ones, size := n.Mask.Size()
+	levels := &t.v6
+	if size == 32 {
+		levels = &t.v4
+		ones += 96
+	}
+	i := sort.Search(len(*levels), func(i int) bool { return (*levels)[i].bits <= ones })
+	if i == len(*levels) || (*levels)[i].bits != ones {
+		*levels = append(*levels, cidrLevel{})
+		copy((*levels)[i+1:], (*levels)[i:])
+		(*levels)[i] = cidrLevel{bits: ones, nets: make(map[[16]byte]*Network)}
+	}
+	(*levels)[i].nets[key(n.IP.To16(), ones)] = &Network{Net: n, Attrs: attrs}
+	return nil
+}
+
+// Lookup returns the longest network holding ip
+func (t *CIDRTable) Lookup(ip net.IP) (*Network, bool) {
+	levels := t.v6
+	if ip.To4() != nil {
+		levels = t.v4
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return nil, false
+	}
+	for _, l := range levels {
+		if n, ok := l.nets[key(ip16, l.bits)]; ok {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the network added as cidr
+func (t *CIDRTable) Get(cidr string) (*Network, bool) {
+	_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return nil, false
+	}
+	ones, size := n.Mask.Size()
+	levels := t.v6
+	if size == 32 {
+		levels = t.v4
+		ones += 96
+	}
+	for _, l := range levels {
+		if l.bits == ones {
+			found, ok := l.nets[key(n.IP.To16(), ones)]
+			return found, ok
+		}
+	}
+	return nil, false
+}
+
+// Len returns the number of networks
+func (t *CIDRTable) Len() int {
+	n := 0
+	for _, l := range t.v4 {
+		n += len(l.nets)
+	}
+	for _, l := range t.v6 {
+		n += len(l.nets)
+	}
+	return n
+}
+
+// LoadCIDRCSV read a csv whose header names the attributes of each column
+// after the first cidr column, # lines are comments and empty values are skipped
+func LoadCIDRCSV(r io.Reader, t *CIDRTable) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("cidr csv header: %s", err.Error())
+	}
+	if len(header) == 0 || strings.TrimSpace(header[0]) != "cidr" {
+		return fmt.Errorf("cidr csv header %v: the first column must be cidr", header)
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		attrs := make(map[string]string)
+		for i := 1; i < len(row); i++ {
+			if v := strings.TrimSpace(row[i]); len(v) > 0 {
+				attrs[strings.TrimSpace(header[i])] = v
+			}
+		}
+		if err := t.Add(row[0], attrs); err != nil {
+			line, _ := cr.FieldPos(0)
+			return fmt.Errorf("cidr csv line %d: %s", line, err.Error())
+		}
+	}
+}
+
+// NewCIDRFile load a cidr csv file
+func NewCIDRFile(file string) (*CIDRTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := NewCIDRTable()
+	if err := LoadCIDRCSV(f, t); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return t, nil
+}
+
+// special purpose ranges, everything else is public
+var reservedNetworks = map[string][]string{
+	"unspecified":   {"0.0.0.0/8", "::/128"},
+	"private":       {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+	"loopback":      {"127.0.0.0/8", "::1/128"},
+	"link_local":    {"169.254.0.0/16", "fe80::/10"},
+	"multicast":     {"224.0.0.0/4", "ff00::/8"},
+	"cgnat":         {"100.64.0.0/10"},
+	"documentation": {"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32"},
+	"reserved":      {"240.0.0.0/4"},
+	"broadcast":     {"255.255.255.255/32"},
+}
+
+var reserved = func() *CIDRTable {
+	t := NewCIDRTable()
+	for class, cidrs := range reservedNetworks {
+		for _, cidr := range cidrs {
+			if err := t.Add(cidr, map[string]string{"network": class}); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return t
+}()
+
+// Classify returns the special purpose class of ip, such as private, loopback,
+// link_local, multicast or cgnat, and public for global addresses
+func Classify(ip net.IP) string {
+	if n, ok := reserved.Lookup(ip); ok {
+		return n.Attrs["network"]
+	}
+	return "public"
+}
@@ -0,0 +1,128 @@
+package ipsearch
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+const networksCSV = `# internal ranges
+cidr,site,datacenter,vlan,owner
+10.0.0.0/8,hz,,,netops
+10.1.0.0/16,hz,hz-a,,
+10.1.2.0/24,hz,hz-a,102,payments
+10.1.2.128/25, hz, hz-a, 103, "payments, risk"
+2001:db8:1::/48,sh,sh-b,,
+`
+
+func TestCIDRTable(t *testing.T) {
+	table := NewCIDRTable()
+	if err := LoadCIDRCSV(strings.NewReader(networksCSV), table); err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 5 {
+		t.Errorf("Len() = %d, but we want 5", table.Len())
+	}
+
+	var tests = []struct {
+		input string
+		cidr  string
+		vlan  string
+		owner string
+	}{
+		{"10.9.9.9", "10.0.0.0/8", "", "netops"},
+		{"10.1.9.9", "10.1.0.0/16", "", ""},
+		{"10.1.2.3", "10.1.2.0/24", "102", "payments"},
+		{"10.1.2.200", "10.1.2.128/25", "103", "payments, risk"},
+		{"::ffff:10.1.2.3", "10.1.2.0/24", "102", "payments"},
+		{"2001:db8:1:ff::1", "2001:db8:1::/48", "", ""},
+		{"2001:db8:2::1", "", "", ""},
+		{"11.0.0.1", "", "", ""},
+	}
+	for _, tt := range tests {
+		n, ok := table.Lookup(net.ParseIP(tt.input))
+		if !ok {
+			if len(tt.cidr) > 0 {
+				t.Errorf("Lookup(%s) found nothing, but we want %s", tt.input, tt.cidr)
+			}
+			continue
+		}
+		if n.Net.String() != tt.cidr || n.Attrs["vlan"] != tt.vlan || n.Attrs["owner"] != tt.owner {
+			t.Errorf("Lookup(%s) = %s %v, but we want %s vlan %q owner %q", tt.input, n.Net, n.Attrs, tt.cidr, tt.vlan, tt.owner)
+		}
+	}
+	if n, _ := table.Lookup(net.ParseIP("10.1.9.9")); n.Attrs["datacenter"] != "hz-a" {
+		t.Errorf("Lookup(10.1.9.9) datacenter = %q, but we want hz-a", n.Attrs["datacenter"])
+	}
+	if n, ok := table.Get("10.1.0.0/16"); !ok || n.Attrs["datacenter"] != "hz-a" {
+		t.Errorf("Get(10.1.0.0/16) = %v %v, but we want datacenter hz-a", n, ok)
+	}
+	if _, ok := table.Get("10.1.0.0/17"); ok {
+		t.Errorf("Get(10.1.0.0/17) should only find networks added as is")
+	}
+	if _, ok := table.Lookup(nil); ok {
+		t.Errorf("Lookup(nil) should find nothing")
+	}
+}
+
+func TestLoadCIDRCSVInvalid(t *testing.T) {
+	var tests = []string{
+		"",
+		"network,site\n10.0.0.0/8,hz\n",
+		"cidr,site\n10.0.0.0/33,hz\n",
+		"cidr,site\n10.0.0.1,hz\n",
+		"cidr,site\n10.0.0.0/8,hz,extra\n",
+	}
+	for _, input := range tests {
+		if err := LoadCIDRCSV(strings.NewReader(input), NewCIDRTable()); err == nil {
+			t.Errorf("LoadCIDRCSV(%q) should fail", input)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"10.1.2.3", "private"},
+		{"172.16.0.1", "private"},
+		{"172.32.0.1", "public"},
+		{"192.168.1.1", "private"},
+		{"127.0.0.1", "loopback"},
+		{"169.254.169.254", "link_local"},
+		{"224.0.0.251", "multicast"},
+		{"100.64.1.1", "cgnat"},
+		{"100.128.0.1", "public"},
+		{"0.0.0.0", "unspecified"},
+		{"255.255.255.255", "broadcast"},
+		{"250.0.0.1", "reserved"},
+		{"203.0.113.9", "documentation"},
+		{"210.51.200.123", "public"},
+		{"::1", "loopback"},
+		{"::", "unspecified"},
+		{"fe80::1", "link_local"},
+		{"fd12:3456::1", "private"},
+		{"ff02::fb", "multicast"},
+		{"2400:cb00::1", "public"},
+	}
+	for _, tt := range tests {
+		if got := Classify(net.ParseIP(tt.input)); got != tt.want {
+			t.Errorf("Classify(%s) = %v, but we want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkCIDRLookup(b *testing.B) {
+	table := NewCIDRTable()
+	for i := 0; i < 4096; i++ {
+		table.Add(fmt.Sprintf("10.%d.%d.0/24", i>>8, i&0xff), map[string]string{"site": "hz"})
+		table.Add(fmt.Sprintf("10.%d.0.0/16", i>>8), map[string]string{"site": "hz"})
+	}
+	ip := net.ParseIP("10.15.200.1")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Lookup(ip)
+	}
+}
@@ -1,10 +1,11 @@
 package ipsearch
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net"
-	"strconv"
 	"strings"
 )
 
@@ -32,66 +33,159 @@ type IPSearch struct {
 	prefixCount        uint32
 }
 
+const (
+	headerSize      = 16
+	prefixEntrySize = 9
+	indexEntrySize  = 12
+)
+
+// ErrShortHeader is returned for data smaller than the header
+var ErrShortHeader = errors.New("ipsearch: data shorter than the 16 bytes header")
+
+// OffsetError is returned when an offset of the data points outside of it
+type OffsetError struct {
+	What   string
+	Offset uint64
+	Size   int
+}
+
+func (e *OffsetError) Error() string {
+	return fmt.Sprintf("ipsearch: %s offset %d out of %d bytes", e.What, e.Offset, e.Size)
+}
+
+// RangeError is returned for inconsistent start and end offsets or indexes
+type RangeError struct {
+	What       string
+	Start, End uint32
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("ipsearch: %s start %d after end %d", e.What, e.Start, e.End)
+}
+
 //New IPSearch
 func New(regionIPFile string) (*IPSearch, error) {
+	return Load(regionIPFile)
+}
 
-	ips, err := loadIPDat(regionIPFile)
+//Load read and check a region ip file
+func Load(regionIPFile string) (*IPSearch, error) {
+	//加载ip地址库信息
+	data, err := ioutil.ReadFile(regionIPFile)
 	if err != nil {
-		log.Fatal("the IP Dat loaded failed!")
-		return ips, err
+		return nil, err
 	}
-	return ips, nil
+	return FromBytes(data)
 }
 
-func loadIPDat(regionIPFile string) (*IPSearch, error) {
+//FromReaderAt read size bytes of region ip data from r
+func FromReaderAt(r io.ReaderAt, size int64) (*IPSearch, error) {
+	if size < headerSize {
+		return nil, ErrShortHeader
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(r, 0, size), data); err != nil {
+		return nil, err
+	}
+	return FromBytes(data)
+}
 
-	p := IPSearch{}
-	//加载ip地址库信息
-	data, err := ioutil.ReadFile(regionIPFile)
-	if err != nil {
-		log.Fatal(err)
+//FromBytes check every offset of the region ip data before indexing it, data is not copied
+func FromBytes(data []byte) (*IPSearch, error) {
+	if len(data) < headerSize {
+		return nil, ErrShortHeader
 	}
+	p := IPSearch{}
 	p.data = data
 	p.prefixMap = make(map[uint32]prefixIndex)
 
 	p.firstStartIPOffset = bytesToLong(data[0], data[1], data[2], data[3])
 	p.prefixStartOffset = bytesToLong(data[8], data[9], data[10], data[11])
 	p.prefixEndOffset = bytesToLong(data[12], data[13], data[14], data[15])
-	p.prefixCount = (p.prefixEndOffset-p.prefixStartOffset)/9 + 1 // 前缀区块每组
+	if err := p.check("first index", uint64(p.firstStartIPOffset), indexEntrySize); err != nil {
+		return nil, err
+	}
+	if p.prefixStartOffset > p.prefixEndOffset || (p.prefixEndOffset-p.prefixStartOffset)%prefixEntrySize != 0 {
+		return nil, &RangeError{"prefix", p.prefixStartOffset, p.prefixEndOffset}
+	}
+	if err := p.check("prefix end", uint64(p.prefixEndOffset), prefixEntrySize); err != nil {
+		return nil, err
+	}
+	p.prefixCount = (p.prefixEndOffset-p.prefixStartOffset)/prefixEntrySize + 1 // 前缀区块每组
 
 	// 初始化前缀对应索引区区间
-	indexBuffer := p.data[p.prefixStartOffset:(p.prefixEndOffset + 9)]
+	var high uint32
+	indexBuffer := p.data[p.prefixStartOffset:(p.prefixEndOffset + prefixEntrySize)]
 	for k := uint32(0); k < p.prefixCount; k++ {
-		i := k * 9
+		i := k * prefixEntrySize
 		prefix := uint32(indexBuffer[i] & 0xFF)
 
 		pf := prefixIndex{}
 		pf.startIndex = bytesToLong(indexBuffer[i+1], indexBuffer[i+2], indexBuffer[i+3], indexBuffer[i+4])
 		pf.endIndex = bytesToLong(indexBuffer[i+5], indexBuffer[i+6], indexBuffer[i+7], indexBuffer[i+8])
+		if pf.startIndex > pf.endIndex {
+			return nil, &RangeError{fmt.Sprintf("prefix %d index", prefix), pf.startIndex, pf.endIndex}
+		}
+		if pf.endIndex > high {
+			high = pf.endIndex
+		}
 		p.prefixMap[prefix] = pf
 
 	}
+
+	// every index entry a lookup can reach, binarySearch falls back to 0, must point inside data
+	if err := p.check("last index", p.indexOffset(high), indexEntrySize); err != nil {
+		return nil, err
+	}
+	for k := uint32(0); k <= high; k++ {
+		ipindex := &ipIndex{}
+		ipindex.getIndex(k, &p)
+		if err := p.check(fmt.Sprintf("index %d location", k), uint64(ipindex.localOffset), uint64(ipindex.localLength)); err != nil {
+			return nil, err
+		}
+		if k == high {
+			break
+		}
+	}
 	return &p, nil
 }
 
-// Get to an ip info string
+//indexOffset returns the offset of the index entry k
+func (p *IPSearch) indexOffset(k uint32) uint64 {
+	return uint64(p.firstStartIPOffset) + uint64(k)*indexEntrySize
+}
+
+//check returns an OffsetError unless length bytes at offset are inside data
+func (p *IPSearch) check(what string, offset, length uint64) error {
+	if offset+length > uint64(len(p.data)) {
+		return &OffsetError{what, offset, len(p.data)}
+	}
+	return nil
+}
+
+// Get to an ip info string, unsupported types and ipv6 addresses return ""
 func (p *IPSearch) Get(ip interface{}) string {
 	var intIP uint32
 
 	switch t := ip.(type) {
 	case string:
-		ips := ip.(string)
-		if len(ips) == 0 {
-			intIP = 0
-			break
+		if len(t) == 0 {
+			return ""
 		}
-		intIP = IpToLong(ip.(string))
+		intIP = IpToLong(t)
 	case int:
-		intIP = uint32(ip.(int))
+		intIP = uint32(t)
+	case int64:
+		intIP = uint32(t)
 	case uint32:
-		intIP = ip.(uint32)
+		intIP = t
+	case net.IP:
+		n, ok := IPToUint32(t)
+		if !ok {
+			return ""
+		}
+		intIP = n
 	default:
-		log.Fatalf("ip type not support %s", t)
 		return ""
 	}
 
@@ -192,21 +286,19 @@ func (p *ipIndex) getLocal(ips *IPSearch) string {
 
 }
 
+//IpToLong convert a dotted ipv4 or ipv4-mapped ipv6 address, anything else is 0
 func IpToLong(ip string) uint32 {
-	quads := strings.Split(ip, ".")
-	if len(quads) != 4 {
-		return 0
-	}
-	var result uint32
-	a, _ := strconv.Atoi(quads[3])
-	result += uint32(a)
-	b, _ := strconv.Atoi(quads[2])
-	result += uint32(b) << 8
-	c, _ := strconv.Atoi(quads[1])
-	result += uint32(c) << 16
-	d, _ := strconv.Atoi(quads[0])
-	result += uint32(d) << 24
-	return result
+	n, _ := IPToUint32(net.ParseIP(ip))
+	return n
+}
+
+//IPToUint32 returns the integer of an ipv4 address, ok is false for ipv6 addresses
+func IPToUint32(ip net.IP) (n uint32, ok bool) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, false
+	}
+	return uint32(ip4[0])<<24 | uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3]), true
 }
 
 //LongToIp Convert uint to net.IP
@@ -2,6 +2,7 @@ package ipsearch
 
 import (
 	"fmt"
+	"net"
 	"testing"
 )
 
@@ -27,6 +28,11 @@ func TestGet(t *testing.T) {
 		{0, ``},
 		{"210.51.200.123", `亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215`},
 		{3526609019, `亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215`},
+		{"::ffff:210.51.200.123", `亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215`},
+		{net.ParseIP("210.51.200.123"), `亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215`},
+		{"2001:db8::1", ``},
+		{"not an ip", ``},
+		{true, ``},
 	}
 	p, _ := New("./regionIp.dat")
 	for _, test := range tests {
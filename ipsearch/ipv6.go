@@ -0,0 +1,86 @@
+package ipsearch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ipv6Range struct {
+	start, end net.IP
+	info       string
+}
+
+// IPv6Search search the region of ipv6 addresses in sorted ranges.
+// The database is a text file of "start,end,info" lines where info has the
+// pipe delimited layout of regionIp.dat, blank lines and # comments are skipped.
+type IPv6Search struct {
+	ranges []ipv6Range
+}
+
+//NewIPv6 load an ipv6 range database file
+func NewIPv6(file string) (*IPv6Search, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadIPv6(f)
+}
+
+//LoadIPv6 read ipv6 ranges from r, overlapping ranges are an error
+func LoadIPv6(r io.Reader) (*IPv6Search, error) {
+	p := &IPv6Search{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if len(s) == 0 || s[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(s, ",", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want start,end,info", line)
+		}
+		start := net.ParseIP(strings.TrimSpace(fields[0])).To16()
+		end := net.ParseIP(strings.TrimSpace(fields[1])).To16()
+		if start == nil || end == nil || bytes.Compare(start, end) > 0 {
+			return nil, fmt.Errorf("line %d: invalid range %s - %s", line, fields[0], fields[1])
+		}
+		p.ranges = append(p.ranges, ipv6Range{start, end, fields[2]})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(p.ranges, func(i, j int) bool {
+		return bytes.Compare(p.ranges[i].start, p.ranges[j].start) < 0
+	})
+	for i := 1; i < len(p.ranges); i++ {
+		if bytes.Compare(p.ranges[i].start, p.ranges[i-1].end) <= 0 {
+			return nil, fmt.Errorf("range %s - %s overlaps %s - %s", p.ranges[i].start, p.ranges[i].end,
+				p.ranges[i-1].start, p.ranges[i-1].end)
+		}
+	}
+	return p, nil
+}
+
+//Get returns the info of the range holding ip, or ""
+func (p *IPv6Search) Get(ip net.IP) string {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return ""
+	}
+	// first range ending at or after ip
+	i := sort.Search(len(p.ranges), func(i int) bool {
+		return bytes.Compare(p.ranges[i].end, ip16) >= 0
+	})
+	if i < len(p.ranges) && bytes.Compare(p.ranges[i].start, ip16) <= 0 {
+		return p.ranges[i].info
+	}
+	return ""
+}
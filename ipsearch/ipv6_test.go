@@ -0,0 +1,70 @@
+package ipsearch
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const ipv6DB = `
+# start,end,info
+2001:db8::,2001:db8::ffff,亚洲|中国|北京| |北京|联通|110000|China|CN|116.4|39.9
+2400:da00::,2400:daff:ffff:ffff:ffff:ffff:ffff:ffff,亚洲|中国|广东| |深圳|电信|440300|China|CN|114.0|22.5
+`
+
+func TestIPv6Get(t *testing.T) {
+	p, err := LoadIPv6(strings.NewReader(ipv6DB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"2001:db8::1", "亚洲|中国|北京| |北京|联通|110000|China|CN|116.4|39.9"},
+		{"2001:db8::ffff", "亚洲|中国|北京| |北京|联通|110000|China|CN|116.4|39.9"},
+		{"2001:db8::1:0", ""},
+		{"2400:da12::8", "亚洲|中国|广东| |深圳|电信|440300|China|CN|114.0|22.5"},
+		{"::1", ""},
+		{"ffff::1", ""},
+	}
+	for _, test := range tests {
+		if got := p.Get(net.ParseIP(test.input)); got != test.want {
+			t.Errorf("Get(%q) = %v, but we want %v", test.input, got, test.want)
+		}
+	}
+	if got := p.Get(nil); got != "" {
+		t.Errorf("Get(nil) = %v, but we want empty", got)
+	}
+}
+
+func TestLoadIPv6Invalid(t *testing.T) {
+	var tests = []string{
+		"2001:db8::,2001:db8::ffff",
+		"2001:db8::ffff,2001:db8::,x",
+		"nope,2001:db8::ffff,x",
+		"2001:db8::,2001:db8::ffff,x\n2001:db8::10,2001:db8::1:0,y",
+	}
+	for _, test := range tests {
+		if _, err := LoadIPv6(strings.NewReader(test)); err == nil {
+			t.Errorf("LoadIPv6(%q) should fail", test)
+		}
+	}
+}
+
+func TestIPToUint32(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  uint32
+		ok    bool
+	}{
+		{"210.51.200.123", 3526609019, true},
+		{"::ffff:10.0.0.1", 167772161, true},
+		{"2001:db8::1", 0, false},
+	}
+	for _, test := range tests {
+		if got, ok := IPToUint32(net.ParseIP(test.input)); got != test.want || ok != test.ok {
+			t.Errorf("IPToUint32(%q) = %v, %v, but we want %v, %v", test.input, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package ipsearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+type datEntry struct {
+	start, end uint32
+	info       string
+}
+
+//buildDat lay out a region ip file with one prefix per first octet of the sorted entries
+func buildDat(entries []datEntry) []byte {
+	var index, prefixes, locals bytes.Buffer
+	le := binary.LittleEndian
+	first := uint32(headerSize)
+	localStart := first + uint32(len(entries))*indexEntrySize
+
+	// locals go after the prefix area, count the prefixes first
+	type span struct{ start, end uint32 }
+	var order []uint32
+	spans := map[uint32]*span{}
+	for i, e := range entries {
+		pre := e.start >> 24
+		if s, ok := spans[pre]; ok {
+			s.end = uint32(i)
+		} else {
+			spans[pre] = &span{uint32(i), uint32(i)}
+			order = append(order, pre)
+		}
+	}
+	localStart += uint32(len(order)) * prefixEntrySize
+
+	b := make([]byte, 4)
+	for _, e := range entries {
+		le.PutUint32(b, e.start)
+		index.Write(b)
+		le.PutUint32(b, e.end)
+		index.Write(b)
+		le.PutUint32(b, localStart+uint32(locals.Len()))
+		index.Write(b[:3])
+		index.WriteByte(byte(len(e.info)))
+		locals.WriteString(e.info)
+	}
+	for _, pre := range order {
+		prefixes.WriteByte(byte(pre))
+		le.PutUint32(b, spans[pre].start)
+		prefixes.Write(b)
+		le.PutUint32(b, spans[pre].end)
+		prefixes.Write(b)
+	}
+
+	prefixStart := first + uint32(index.Len())
+	header := make([]byte, headerSize)
+	le.PutUint32(header[0:], first)
+	le.PutUint32(header[4:], prefixStart-indexEntrySize)
+	le.PutUint32(header[8:], prefixStart)
+	le.PutUint32(header[12:], prefixStart+uint32(prefixes.Len())-prefixEntrySize)
+	return bytes.Join([][]byte{header, index.Bytes(), prefixes.Bytes(), locals.Bytes()}, nil)
+}
+
+var testEntries = []datEntry{
+	{0x01000000, 0x010000ff, "亚洲|中国|福建| |福州|电信|350100|China|CN|119.3|26.1"},
+	{0x01000100, 0x0100ffff, "亚洲|中国|广东| |广州|电信|440100|China|CN|113.3|23.1"},
+	{0xd233c800, 0xd233c8ff, "亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215"},
+}
+
+func TestFromBytes(t *testing.T) {
+	p, err := FromBytes(buildDat(testEntries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"1.0.0.1", testEntries[0].info},
+		{"1.0.2.3", testEntries[1].info},
+		{"210.51.200.123", testEntries[2].info},
+		{"1.1.0.0", ""},
+		{"9.9.9.9", ""},
+	}
+	for _, test := range tests {
+		if got := p.Get(test.input); got != test.want {
+			t.Errorf("Get(%q) = %v, but we want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFromReaderAt(t *testing.T) {
+	data, err := ioutil.ReadFile("./regionIp.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := FromReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isp := p.GetISP("210.51.200.123"); isp != "联通" {
+		t.Errorf("GetISP(210.51.200.123) = %v, but we want 联通", isp)
+	}
+	if _, err := FromReaderAt(bytes.NewReader(data[:100]), int64(len(data))); err == nil {
+		t.Errorf("FromReaderAt past the end of the reader should fail")
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	good := buildDat(testEntries)
+	le := binary.LittleEndian
+	patch := func(off int, v uint32) []byte {
+		b := append([]byte(nil), good...)
+		le.PutUint32(b[off:], v)
+		return b
+	}
+	prefixStart := int(le.Uint32(good[8:]))
+
+	var tests = []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "short"},
+		{"short header", good[:15], "short"},
+		{"first index past the end", patch(0, uint32(len(good))), "offset"},
+		{"prefix start after end", patch(8, le.Uint32(good[12:])+prefixEntrySize), "range"},
+		{"prefix area misaligned", patch(12, le.Uint32(good[12:])+1), "range"},
+		{"prefix end past the end", patch(12, le.Uint32(good[12:])+100*prefixEntrySize), "offset"},
+		{"prefix index reversed", patch(prefixStart+1, 2), "range"},
+		{"prefix index past the end", patch(prefixStart+5, 1000), "offset"},
+		{"location past the end", patch(headerSize+8, uint32(len(good))|10<<24), "offset"},
+		{"truncated", good[:len(good)-1], "offset"},
+	}
+	for _, tt := range tests {
+		_, err := FromBytes(tt.data)
+		var ok bool
+		switch tt.want {
+		case "short":
+			ok = err == ErrShortHeader
+		case "offset":
+			_, ok = err.(*OffsetError)
+		case "range":
+			_, ok = err.(*RangeError)
+		}
+		if !ok {
+			t.Errorf("FromBytes(%s) error = %v, but we want a %s error", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := Load("./no-such-file.dat"); err == nil {
+		t.Errorf("Load of a missing file should fail")
+	}
+}
+
+func FuzzFromBytes(f *testing.F) {
+	good := buildDat(testEntries)
+	f.Add(good)
+	f.Add(good[:len(good)/2])
+	f.Add(good[:headerSize])
+	if data, err := ioutil.ReadFile("./regionIp.dat"); err == nil {
+		f.Add(data[:4096])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := FromBytes(data)
+		if err != nil {
+			return
+		}
+		for _, ip := range []uint32{0x01000001, 0x0100ff00, 0xd233c87b, 0xffffffff, 1} {
+			p.Get(ip)
+		}
+		// addresses built from the data itself reach its own prefixes
+		for i := 0; i+4 <= len(data) && i < 64; i += 4 {
+			p.Get(binary.BigEndian.Uint32(data[i:]))
+		}
+	})
+}
+
+func FuzzLoadIPv6(f *testing.F) {
+	f.Add(ipv6DB)
+	f.Add("::,::1,x\n::2,::3,y")
+	f.Fuzz(func(t *testing.T, db string) {
+		p, err := LoadIPv6(strings.NewReader(db))
+		if err != nil {
+			return
+		}
+		for _, ip := range []string{"::", "::1", "2001:db8::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"} {
+			p.Get(net.ParseIP(ip))
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package ipsearch
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Record is the structured location of an ip address
+type Record struct {
+	Continent   string
+	Country     string
+	CountryCode string
+	Region      string
+	City        string
+	ISP         string
+	ASN         uint32
+	ASOrg       string
+	Latitude    float64
+	Longitude   float64
+	// the qqzeng info string of the record, empty for the other backends
+	Info string
+}
+
+// IPLookup find the record of an ip address, ok is false when the address is unknown
+type IPLookup interface {
+	Lookup(ip net.IP) (rec Record, ok bool)
+}
+
+// ParseQQZeng split a qqzeng info string
+// 洲|国家|省份|城市|区县|运营商|区划代码|国家英文|国家简码|经度|纬度
+func ParseQQZeng(info string) (Record, bool) {
+	sl := strings.Split(info, "|")
+	if len(sl) < 11 || sl[5] == "qqzeng-ip" {
+		return Record{}, false
+	}
+	rec := Record{
+		Continent:   strings.TrimSpace(sl[0]),
+		Country:     strings.TrimSpace(sl[1]),
+		Region:      strings.TrimSpace(sl[2]),
+		City:        strings.TrimSpace(sl[3]),
+		ISP:         strings.TrimSpace(sl[5]),
+		CountryCode: strings.TrimSpace(sl[8]),
+		Info:        info,
+	}
+	// municipalities and counties leave the city blank
+	if len(rec.City) == 0 {
+		rec.City = strings.TrimSpace(sl[4])
+	}
+	rec.Longitude, _ = strconv.ParseFloat(strings.TrimSpace(sl[9]), 64)
+	rec.Latitude, _ = strconv.ParseFloat(strings.TrimSpace(sl[10]), 64)
+	return rec, true
+}
+
+// QQZeng is the IPLookup of the qqzeng regionIp.dat with an optional ipv6 range table
+type QQZeng struct {
+	V4 *IPSearch
+	V6 *IPv6Search
+}
+
+// Lookup implements IPLookup
+func (q *QQZeng) Lookup(ip net.IP) (Record, bool) {
+	var info string
+	if n, ok := IPToUint32(ip); ok {
+		if q.V4 == nil {
+			return Record{}, false
+		}
+		info = q.V4.Get(n)
+	} else {
+		if q.V6 == nil {
+			return Record{}, false
+		}
+		info = q.V6.Get(ip)
+	}
+	if len(info) == 0 {
+		return Record{}, false
+	}
+	return ParseQQZeng(info)
+}
@@ -0,0 +1,60 @@
+package ipsearch
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseQQZeng(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  Record
+		ok    bool
+	}{
+		{`亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215`,
+			Record{Continent: "亚洲", Country: "中国", CountryCode: "CN", Region: "湖北", City: "潜江", ISP: "联通", Latitude: 30.421215, Longitude: 112.896866,
+				Info: `亚洲|中国|湖北| |潜江|联通|429005|China|CN|112.896866|30.421215`}, true},
+		{`亚洲|中国|广东|深圳|南山|电信|440305|China|CN|113.9|22.5`,
+			Record{Continent: "亚洲", Country: "中国", CountryCode: "CN", Region: "广东", City: "深圳", ISP: "电信", Latitude: 22.5, Longitude: 113.9,
+				Info: `亚洲|中国|广东|深圳|南山|电信|440305|China|CN|113.9|22.5`}, true},
+		{`||||||||||`, Record{Info: `||||||||||`}, true},
+		{`a|b|c`, Record{}, false},
+		{`亚洲|中国| | | |qqzeng-ip|||||`, Record{}, false},
+	}
+	for _, test := range tests {
+		if got, ok := ParseQQZeng(test.input); got != test.want || ok != test.ok {
+			t.Errorf("ParseQQZeng(%q) = %+v, %v, but we want %+v, %v", test.input, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestQQZengLookup(t *testing.T) {
+	p, err := New("./regionIp.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q IPLookup = &QQZeng{V4: p}
+	if rec, ok := q.Lookup(net.ParseIP("210.51.200.123")); !ok || rec.ISP != "联通" || rec.City != "潜江" {
+		t.Errorf("Lookup(210.51.200.123) = %+v, %v, but we want 联通 潜江", rec, ok)
+	}
+	if _, ok := q.Lookup(net.ParseIP("2001:db8::1")); ok {
+		t.Errorf("Lookup(2001:db8::1) without ipv6 table should not be found")
+	}
+}
+
+func TestMMDBRecord(t *testing.T) {
+	var r mmdbRecord
+	r.Continent.Names = map[string]string{"en": "Asia", "zh-CN": "亚洲"}
+	r.Country.ISOCode = "JP"
+	r.Country.Names = map[string]string{"en": "Japan"}
+	r.Subdivisions = append(r.Subdivisions, struct {
+		Names map[string]string `maxminddb:"names"`
+	}{map[string]string{"en": "Tokyo"}})
+	r.Location.Latitude, r.Location.Longitude = 35.6, 139.7
+	r.ASN, r.ASOrg = 2516, "KDDI"
+
+	want := Record{Continent: "亚洲", Country: "Japan", CountryCode: "JP", Region: "Tokyo", ISP: "KDDI", ASN: 2516, ASOrg: "KDDI", Latitude: 35.6, Longitude: 139.7}
+	if got := r.record("zh-CN"); got != want {
+		t.Errorf("record(zh-CN) = %+v, but we want %+v", got, want)
+	}
+}
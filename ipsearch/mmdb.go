@@ -0,0 +1,104 @@
+package ipsearch
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdbRecord holds the fields of the GeoLite2/GeoIP2 City, ISP and ASN databases
+type mmdbRecord struct {
+	Continent struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	ISP   string `maxminddb:"isp"`
+	ASN   uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// name returns the name in lang, falling back to english
+func name(names map[string]string, lang string) string {
+	if n, ok := names[lang]; ok {
+		return n
+	}
+	return names["en"]
+}
+
+func (r *mmdbRecord) record(lang string) Record {
+	rec := Record{
+		Continent:   name(r.Continent.Names, lang),
+		Country:     name(r.Country.Names, lang),
+		CountryCode: r.Country.ISOCode,
+		City:        name(r.City.Names, lang),
+		ISP:         r.ISP,
+		ASN:         r.ASN,
+		ASOrg:       r.ASOrg,
+		Latitude:    r.Location.Latitude,
+		Longitude:   r.Location.Longitude,
+	}
+	if len(r.Subdivisions) > 0 {
+		rec.Region = name(r.Subdivisions[0].Names, lang)
+	}
+	// the ASN databases only carry the organization
+	if len(rec.ISP) == 0 {
+		rec.ISP = r.ASOrg
+	}
+	return rec
+}
+
+// MMDB is the IPLookup of a MaxMind database
+type MMDB struct {
+	reader *maxminddb.Reader
+	lang   string
+}
+
+// OpenMMDB open a MaxMind database, names are returned in lang or english
+func OpenMMDB(file, lang string) (*MMDB, error) {
+	r, err := maxminddb.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(lang) == 0 {
+		lang = "en"
+	}
+	return &MMDB{reader: r, lang: lang}, nil
+}
+
+// Lookup implements IPLookup
+func (m *MMDB) Lookup(ip net.IP) (Record, bool) {
+	var r mmdbRecord
+	_, ok, err := m.reader.LookupNetwork(ip, &r)
+	if err != nil || !ok {
+		return Record{}, false
+	}
+	return r.record(m.lang), true
+}
+
+// LookupASN implements ASNLookup on a GeoLite2/GeoIP2 ASN or ISP database
+func (m *MMDB) LookupASN(ip net.IP) (ASN, bool) {
+	var r mmdbRecord
+	_, ok, err := m.reader.LookupNetwork(ip, &r)
+	if err != nil || !ok || r.ASN == 0 {
+		return ASN{}, false
+	}
+	return ASN{Number: r.ASN, Org: r.ASOrg}, true
+}
+
+// Close unmap the database
+func (m *MMDB) Close() error {
+	return m.reader.Close()
+}
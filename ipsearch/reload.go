@@ -0,0 +1,116 @@
+package ipsearch
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// how long a replaced database stays open for lookups still running on it
+var reloadGrace = time.Minute
+
+// lookupHolder gives atomic.Value a single concrete type
+type lookupHolder struct {
+	IPLookup
+}
+
+// Reloader is an IPLookup whose database is swapped atomically, lookups never wait for a reload
+type Reloader struct {
+	current atomic.Value
+	load    func() (IPLookup, error)
+	files   []string
+
+	mu     sync.Mutex
+	mtimes []time.Time
+
+	// OnReload is called after each database swap, set it before Watch
+	OnReload func()
+}
+
+// NewReloader load the first database, files are watched for changes by Watch
+func NewReloader(load func() (IPLookup, error), files ...string) (*Reloader, error) {
+	r := &Reloader{load: load, files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Lookup implements IPLookup on the current database
+func (r *Reloader) Lookup(ip net.IP) (Record, bool) {
+	return r.current.Load().(lookupHolder).Lookup(ip)
+}
+
+func (r *Reloader) stat() []time.Time {
+	mtimes := make([]time.Time, len(r.files))
+	for i, f := range r.files {
+		if fi, err := os.Stat(f); err == nil {
+			mtimes[i] = fi.ModTime()
+		}
+	}
+	return mtimes
+}
+
+// Reload load the database again and swap it in, the current one is kept when loading fails
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mtimes := r.stat()
+	db, err := r.load()
+	if err != nil {
+		return err
+	}
+	old, _ := r.current.Load().(lookupHolder)
+	r.current.Store(lookupHolder{db})
+	r.mtimes = mtimes
+
+	if c, ok := old.IPLookup.(io.Closer); ok {
+		time.AfterFunc(reloadGrace, func() { c.Close() })
+	}
+	if r.OnReload != nil {
+		r.OnReload()
+	}
+	return nil
+}
+
+// changed reports whether a watched file was modified since the last load
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, mt := range r.stat() {
+		if !mt.Equal(r.mtimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reload the database every interval its files changed, until stop is closed
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("Keep the current ip database, reload %v fail: %s", r.files, err.Error())
+				// don't retry the same broken files every tick
+				r.mu.Lock()
+				r.mtimes = r.stat()
+				r.mu.Unlock()
+				continue
+			}
+			log.Printf("Reload ip database %v done ...", r.files)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ipsearch
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good, err := ioutil.ReadFile("./regionIp.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "regionIp.dat")
+	if err := ioutil.WriteFile(file, good, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loads := 0
+	r, err := NewReloader(func() (IPLookup, error) {
+		p, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+		loads++
+		return &QQZeng{V4: p}, nil
+	}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("210.51.200.123")
+
+	// lookups keep working while reloads swap the database
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if rec, ok := r.Lookup(ip); !ok || rec.ISP != "联通" {
+				t.Errorf("Lookup during reload = %+v, %v", rec, ok)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := r.Reload(); err != nil {
+			t.Errorf("Reload fail: %s", err.Error())
+		}
+	}
+
+	// a truncated file is rejected and the loaded database stays
+	if err := ioutil.WriteFile(file, good[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Errorf("Reload of a truncated file should fail")
+	}
+	close(stop)
+	wg.Wait()
+	if rec, ok := r.Lookup(ip); !ok || rec.ISP != "联通" {
+		t.Errorf("Lookup after a failed reload = %+v, %v, but we want the old database", rec, ok)
+	}
+
+	// Watch picks up the fixed file
+	if err := ioutil.WriteFile(file, good, 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(file, future, future)
+	n := loads
+	stop = make(chan struct{})
+	go r.Watch(10*time.Millisecond, stop)
+	defer close(stop)
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if !r.changed() {
+			break
+		}
+	}
+	if r.changed() || loads != n+1 {
+		t.Errorf("Watch did not reload the changed file, %d loads", loads-n)
+	}
+}
@@ -0,0 +1,128 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// now is replaced by tests
+var now = time.Now
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+//Stats of a Cache
+type Stats struct {
+	Size      int     `json:"size"`
+	Len       int     `json:"len"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	HitRate   float64 `json:"hitRate"`
+}
+
+//Cache is a concurrency safe LRU cache of at most size entries, entries older than ttl are misses
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+//New returns a Cache, a ttl of 0 keeps entries until they are evicted
+func New(size int, ttl time.Duration) *Cache {
+	if size <= 0 {
+		size = 1
+	}
+	return &Cache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+//Get returns the value of key and marks it as recently used
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if c.ttl > 0 && now().After(e.expires) {
+		c.remove(el)
+		c.misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits++
+	return e.value, true
+}
+
+//Add set the value of key, the least recently used entry is evicted when the cache is full
+func (c *Cache) Add(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = now().Add(c.ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key, value, expires})
+	if c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+		c.evictions++
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
+
+//Purge remove every entry, the counters are kept
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+//Len returns the number of entries, expired ones included
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+//Stats returns the counters of the cache
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Stats{
+		Size:      c.size,
+		Len:       c.ll.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		s.HitRate = float64(c.hits) / float64(total)
+	}
+	return s
+}
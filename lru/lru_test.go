@@ -0,0 +1,80 @@
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := New(2, 0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v %v, but we want 1 true", v, ok)
+	}
+	// b is now the least recently used
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Get(b) should miss after eviction")
+	}
+	c.Add("a", 10)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("Get(a) = %v, but we want 10", v)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, but we want 2", c.Len())
+	}
+
+	want := Stats{Size: 2, Len: 2, Hits: 2, Misses: 1, Evictions: 1, HitRate: 2.0 / 3}
+	if s := c.Stats(); s != want {
+		t.Errorf("Stats() = %+v, but we want %+v", s, want)
+	}
+
+	c.Purge()
+	if _, ok := c.Get("c"); ok || c.Len() != 0 {
+		t.Errorf("Purge should remove every entry")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ts := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return ts }
+	defer func() { now = time.Now }()
+
+	c := New(10, time.Minute)
+	c.Add("a", 1)
+	ts = ts.Add(59 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Get(a) should hit before the ttl")
+	}
+	ts = ts.Add(2 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get(a) should miss after the ttl")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, but we want the expired entry removed", c.Len())
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := New(100, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				k := fmt.Sprint((i * j) % 300)
+				if _, ok := c.Get(k); !ok {
+					c.Add(k, j)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if s := c.Stats(); s.Len > 100 || s.Hits+s.Misses != 8000 {
+		t.Errorf("Stats() = %+v, but we want at most 100 entries and 8000 gets", s)
+	}
+}
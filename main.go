@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -8,45 +9,103 @@ import (
 	"github.com/chenyoufu/yfstream/alert"
 	"github.com/chenyoufu/yfstream/cook"
 	"github.com/chenyoufu/yfstream/dump"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/expr"
 	"github.com/chenyoufu/yfstream/g"
+	"github.com/chenyoufu/yfstream/http"
 	"github.com/chenyoufu/yfstream/pull"
 	"os"
 	"runtime"
+	"time"
 )
 
-func input(out chan<- string) {
-	var kafkaPCs = pull.InitKafkaPCS()
-	for {
-		for _, pc := range kafkaPCs {
-			select {
-			case msg := <-pc.Messages():
-				b, err := pull.SemiCooKafkaMsg(msg)
-				if err != nil {
-					break
-				}
-				out <- string(b)
-			default:
-			}
-		}
+func input(out chan<- *event.Event) {
+	if g.Config().Pull.NSQ.Enabled {
+		pull.InitNSQConsumer(out)
+	}
+	if g.Config().Pull.Mongo.Enabled {
+		go pull.TailMongo(out)
+	}
+	if g.Config().Pull.Socket.Enabled {
+		go pull.ListenSocket(out)
+	}
+	if g.Config().Pull.Kafka.Enabled {
+		pull.ConsumeKafka(out)
+	}
+}
+
+//output is a sink channel and the route condition events must match to reach it.
+//An optional output never fails the events it misses, so it can't hold the source checkpoints.
+type output struct {
+	name     string
+	when     *expr.Expr
+	c        chan<- *event.Event
+	optional bool
+}
+
+func newOutput(name string, c chan<- *event.Event) output {
+	o := output{name: name, c: c}
+	if when, ok := g.Config().Routes[name]; ok {
+		// conditions are validated when the config is parsed
+		o.when = expr.MustCompile(when)
 	}
+	return o
 }
 
-func filter(in <-chan string, outC ...chan<- string) {
+var errOutputFull = errors.New("output channel full")
+
+// how long filter waits for a full output channel before the event misses it
+var outputTimeout = 5 * time.Second
+
+//send hand e to the output, waiting up to outputTimeout while its channel is full
+func (o output) send(e *event.Event) bool {
+	select {
+	case o.c <- e:
+		return true
+	default:
+	}
+	t := time.NewTimer(outputTimeout)
+	defer t.Stop()
+	select {
+	case o.c <- e:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+func filter(in <-chan *event.Event, outs ...output) {
 	var cooker = cook.InitCooker()
 
-	for msg := range in {
-		b, err := cooker.Cook(msg)
-		if err != nil {
+	for e := range in {
+		// dropped and malformed events are settled, redelivery would not change them
+		if err := cooker.CookEvent(e); err != nil {
+			e.Done(nil)
+			continue
+		}
+		// encode once before the outputs share the event
+		if _, err := e.Bytes(); err != nil {
+			e.Done(nil)
 			continue
 		}
-		//output cooked message to all out channels
-		for i, c := range outC {
-			select {
-			case c <- string(b):
-			default:
-				log.Printf("Length Channel %d: %d, Send failed!\n", i, len(outC))
+		e.Stamp(event.StageRoute)
+		//output cooked event to all routed out channels, each holds it until written
+		for _, o := range outs {
+			if o.when != nil && !o.when.Eval(e.Get) {
+				continue
+			}
+			e.Hold(1)
+			if o.send(e) {
+				continue
+			}
+			log.Printf("Length Channel %s: %d, Send failed!\n", o.name, len(o.c))
+			if o.optional {
+				e.Done(nil)
+			} else {
+				e.Done(errOutputFull)
 			}
 		}
+		e.Done(nil)
 	}
 
 }
@@ -66,14 +125,65 @@ func main() {
 	g.ParseConfig(*cfg)
 	fmt.Println(g.Config())
 
-	var pipeC = make(chan string, 64)
-	var alertC = make(chan string, 64)
-	var esC = make(chan string, 64)
+	var pipeC = make(chan *event.Event, 64)
+	var alertC = make(chan *event.Event, 64)
+	var esC = make(chan *event.Event, 64)
+	var outs = []output{newOutput("alert", alertC), newOutput("es", esC)}
 
-	go input(pipeC)
-	go filter(pipeC, alertC, esC)
 	go alert.Alerter(alertC)
 	go dump.Dump2ES(esC)
 
+	if g.Config().Dump.NSQ.Enabled {
+		var nsqC = make(chan *event.Event, 64)
+		outs = append(outs, newOutput("nsq", nsqC))
+		go dump.Dump2NSQ(nsqC)
+	}
+	if g.Config().Dump.Mongo.Enabled {
+		var mongoC = make(chan *event.Event, 64)
+		outs = append(outs, newOutput("mongodb", mongoC))
+		go dump.Dump2Mongo(mongoC)
+	}
+	if g.Config().Dump.Kafka.Enabled {
+		var kafkaC = make(chan *event.Event, 64)
+		outs = append(outs, newOutput("kafka", kafkaC))
+		go dump.Dump2Kafka(kafkaC)
+	}
+	if g.Config().Dump.File.Enabled {
+		var fileC = make(chan *event.Event, 64)
+		outs = append(outs, newOutput("file", fileC))
+		go dump.Dump2File(fileC)
+	}
+	if g.Config().Dump.Stdout.Enabled || g.Config().Debug {
+		var stdoutC = make(chan *event.Event, 64)
+		stdout := newOutput("stdout", stdoutC)
+		stdout.optional = true
+		outs = append(outs, stdout)
+		go dump.Dump2Stdout(stdoutC)
+	}
+	if g.Config().Dump.Socket.Enabled {
+		var socketC = make(chan *event.Event, 64)
+		outs = append(outs, newOutput("socket", socketC))
+		go dump.Dump2Socket(socketC)
+	}
+	if g.Config().Dump.Redis.Enabled {
+		var redisC = make(chan *event.Event, 64)
+		outs = append(outs, newOutput("redis", redisC))
+		go dump.Dump2Redis(redisC)
+	}
+
+	for name := range g.Config().Routes {
+		found := false
+		for _, o := range outs {
+			found = found || o.name == name
+		}
+		if !found {
+			log.Printf("Route %s matches no enabled sink", name)
+		}
+	}
+
+	go http.Start()
+	go input(pipeC)
+	go filter(pipeC, outs...)
+
 	select {}
 }
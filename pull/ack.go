@@ -0,0 +1,90 @@
+package pull
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+)
+
+type ackSlot struct {
+	pos    interface{}
+	acked  bool
+	failed bool
+}
+
+//ackWindow tracks the positions of a source in the order their events were handed to
+//the pipeline, its checkpoint is the last position acked with every position before it.
+//A failed delivery holds the checkpoint before it, a restart delivers the event again,
+//the positions after it are still tracked.
+type ackWindow struct {
+	name    string
+	mu      sync.Mutex
+	base    uint64 // sequence of pending[0]
+	pending []ackSlot
+	last    interface{}
+}
+
+func newAckWindow(name string, start interface{}) *ackWindow {
+	return &ackWindow{name: name, last: start}
+}
+
+//add record pos as the next position in flight and returns its sequence
+func (w *ackWindow) add(pos interface{}) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seq := w.base + uint64(len(w.pending))
+	w.pending = append(w.pending, ackSlot{pos: pos})
+	return seq
+}
+
+//ack settle the position of seq, the checkpoint moves over every contiguous acked position
+func (w *ackWindow) ack(seq uint64, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq < w.base || seq >= w.base+uint64(len(w.pending)) {
+		return
+	}
+	slot := &w.pending[seq-w.base]
+	if slot.acked || slot.failed {
+		return
+	}
+	if err != nil {
+		// the checkpoint stops before this position until restart
+		log.Printf("Hold %s checkpoint before %v, its event was not delivered: %s", w.name, slot.pos, err.Error())
+		slot.failed = true
+		return
+	}
+	slot.acked = true
+	n := 0
+	for n < len(w.pending) && w.pending[n].acked {
+		w.last = w.pending[n].pos
+		n++
+	}
+	w.pending = append(w.pending[:0], w.pending[n:]...)
+	w.base += uint64(n)
+}
+
+//checkpoint returns the position a restart may resume after
+func (w *ackWindow) checkpoint() interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+//saveCheckpoint write the json of v through a temp file so it is never torn
+func saveCheckpoint(path string, v interface{}) error {
+	if len(path) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,44 @@
+package pull
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAckWindow(t *testing.T) {
+	w := newAckWindow("test", -1)
+	var seqs []uint64
+	for pos := 10; pos < 15; pos++ {
+		seqs = append(seqs, w.add(pos))
+	}
+
+	var tests = []struct {
+		seq  uint64
+		err  error
+		want interface{}
+	}{
+		{seqs[1], nil, -1}, // 10 is still in flight
+		{seqs[0], nil, 11},
+		{seqs[0], nil, 11}, // acked twice
+		{seqs[3], nil, 11},
+		{seqs[2], nil, 13},
+		{seqs[4], errors.New("sink down"), 13},
+	}
+	for _, tt := range tests {
+		w.ack(tt.seq, tt.err)
+		if got := w.checkpoint(); got != tt.want {
+			t.Errorf("ack(%d, %v) checkpoint = %v, but we want %v", tt.seq, tt.err, got, tt.want)
+		}
+	}
+
+	// nothing moves the checkpoint over a failed delivery, the positions after it are still tracked
+	seq := w.add(15)
+	w.ack(seq, nil)
+	w.ack(seqs[4], nil)
+	if got := w.checkpoint(); got != 13 {
+		t.Errorf("checkpoint = %v after a failed delivery, but we want 13", got)
+	}
+	if n := len(w.pending); n != 2 || !w.pending[0].failed || !w.pending[1].acked {
+		t.Errorf("pending = %v, but we want the failed delivery and the acked one after it", w.pending)
+	}
+}
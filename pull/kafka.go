@@ -1,31 +1,118 @@
 package pull
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/Shopify/sarama"
-	"github.com/bitly/go-simplejson"
+	"github.com/chenyoufu/yfstream/event"
 	"github.com/chenyoufu/yfstream/g"
+	"io/ioutil"
 	"log"
+	"os"
+	"time"
 )
 
-//SemiCooKafkaMsg merge the kafka metadata to message
-func SemiCooKafkaMsg(msg *sarama.ConsumerMessage) ([]byte, error) {
-	js, err := simplejson.NewJson(msg.Value)
+//SemiCooKafkaMsg wrap the message in an event with its kafka coordinates as metadata
+func SemiCooKafkaMsg(msg *sarama.ConsumerMessage) *event.Event {
+	e := event.New(msg.Value)
+	e.Meta["kafka"] = map[string]interface{}{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	}
+	return e
+}
+
+//kafkaOffsets are the offsets every output settled, per topic and partition
+type kafkaOffsets struct {
+	path     string
+	saved    map[string]int64
+	windows  map[string]*ackWindow
+	lastSave time.Time
+}
+
+func kafkaPartitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
+//loadKafkaOffsets read the offsets file, a missing file means start from the newest messages
+func loadKafkaOffsets(path string) (*kafkaOffsets, error) {
+	o := &kafkaOffsets{path: path, saved: make(map[string]int64), windows: make(map[string]*ackWindow)}
+	if len(path) == 0 {
+		return o, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	return o, json.Unmarshal(b, &o.saved)
+}
+
+//next returns the offset to consume partition from, the one after its checkpoint
+func (o *kafkaOffsets) next(topic string, partition int32) int64 {
+	if offset, ok := o.saved[kafkaPartitionKey(topic, partition)]; ok {
+		return offset + 1
+	}
+	return sarama.OffsetNewest
+}
+
+//track set the ack of the event of msg, its offset is checkpointed once every output settled it
+func (o *kafkaOffsets) track(e *event.Event, msg *sarama.ConsumerMessage) {
+	key := kafkaPartitionKey(msg.Topic, msg.Partition)
+	w, ok := o.windows[key]
+	if !ok {
+		start, ok := o.saved[key]
+		if !ok {
+			start = -1
+		}
+		w = newAckWindow("kafka "+key, start)
+		o.windows[key] = w
+	}
+	seq := w.add(msg.Offset)
+	e.SetAck(func(err error) { w.ack(seq, err) })
+}
+
+//save persist the checkpoint of every partition
+func (o *kafkaOffsets) save() {
+	for key, w := range o.windows {
+		if offset := w.checkpoint().(int64); offset >= 0 {
+			o.saved[key] = offset
+		}
+	}
+	if err := saveCheckpoint(o.path, o.saved); err != nil {
+		log.Printf("Can't save kafka offsets to %s: %s", o.path, err.Error())
+	}
+	o.lastSave = time.Now()
+}
 
-	js.SetPath([]string{"kafka", "topic"}, msg.Topic)
-	js.SetPath([]string{"kafka", "partition"}, msg.Partition)
-	js.SetPath([]string{"kafka", "offset"}, msg.Offset)
-	bs, err := js.MarshalJSON()
+//ConsumeKafka hand the messages of the configured topics to out channel forever
+func ConsumeKafka(out chan<- *event.Event) {
+	offsets, err := loadKafkaOffsets(g.Config().Pull.Kafka.OffsetFile)
 	if err != nil {
-		return nil, err
+		log.Panic(err)
+	}
+	pcs := InitKafkaPCS(offsets)
+	for {
+		for _, pc := range pcs {
+			select {
+			case msg := <-pc.Messages():
+				e := SemiCooKafkaMsg(msg)
+				offsets.track(e, msg)
+				out <- e
+			default:
+			}
+		}
+		if time.Since(offsets.lastSave) >= time.Second {
+			offsets.save()
+		}
 	}
-	return bs, nil
 }
 
-//InitKafkaPCS returns the kafka consumer partition channels
-func InitKafkaPCS() (pcs []sarama.PartitionConsumer) {
+//InitKafkaPCS returns the kafka consumer partition channels, from the saved offsets
+func InitKafkaPCS(offsets *kafkaOffsets) (pcs []sarama.PartitionConsumer) {
 
 	kafkaConfig := sarama.NewConfig()
 	kafkaConfig.Net.MaxOpenRequests = 16
@@ -49,8 +136,7 @@ func InitKafkaPCS() (pcs []sarama.PartitionConsumer) {
 		}
 
 		for _, partition := range partitionList {
-			offset := loadOffset(topic, partition)
-			// offset = sarama.OffsetOldest
+			offset := offsets.next(topic, partition)
 			pc, err := consumer.ConsumePartition(topic, partition, offset)
 			if err != nil {
 				log.Panic(err)
@@ -63,9 +149,3 @@ func InitKafkaPCS() (pcs []sarama.PartitionConsumer) {
 
 	return pcs
 }
-
-// should fetch max offset per topic-partition from es
-// should return max offset+1
-func loadOffset(topic string, partition int32) int64 {
-	return sarama.OffsetNewest
-}
@@ -0,0 +1,49 @@
+package pull
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/chenyoufu/yfstream/event"
+)
+
+func TestKafkaOffsets(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kafka.offsets")
+
+	o, err := loadKafkaOffsets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := o.next("packetbeat", 0); offset != sarama.OffsetNewest {
+		t.Errorf("next() = %d without offsets, but we want the newest", offset)
+	}
+
+	var events []*event.Event
+	for offset := int64(5); offset < 8; offset++ {
+		e := event.New([]byte(`{}`))
+		o.track(e, &sarama.ConsumerMessage{Topic: "packetbeat", Partition: 0, Offset: offset})
+		events = append(events, e)
+	}
+	e := event.New([]byte(`{}`))
+	o.track(e, &sarama.ConsumerMessage{Topic: "packetbeat", Partition: 1, Offset: 3})
+
+	events[0].Done(nil)
+	events[2].Done(nil)
+	o.save()
+
+	o, err = loadKafkaOffsets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := o.next("packetbeat", 0); offset != 6 {
+		t.Errorf("next(packetbeat, 0) = %d, but we want 6", offset)
+	}
+	if offset := o.next("packetbeat", 1); offset != sarama.OffsetNewest {
+		t.Errorf("next(packetbeat, 1) = %d, but we want the newest as nothing was acked", offset)
+	}
+}
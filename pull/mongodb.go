@@ -1 +1,199 @@
 package pull
+
+import (
+	"encoding/json"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// how long a tailable cursor waits for new documents before checkpointing
+var mongoTailTimeout = 5 * time.Second
+
+//mongoResume is the tail position persisted between restarts
+type mongoResume struct {
+	TS bson.MongoTimestamp `json:"ts,omitempty"`
+	ID bson.ObjectId       `json:"id,omitempty"`
+}
+
+//loadMongoResume read the resume position, a missing file means start from now
+func loadMongoResume(path string) (mongoResume, error) {
+	var r mongoResume
+	if len(path) == 0 {
+		return r, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(b, &r)
+	return r, err
+}
+
+//saveMongoResume write the resume position
+func saveMongoResume(path string, r mongoResume) error {
+	return saveCheckpoint(path, r)
+}
+
+type mongoIter interface {
+	Next(result interface{}) bool
+	Timeout() bool
+	Close() error
+}
+
+//mongoTailer follows the oplog entries of a namespace or a capped collection
+type mongoTailer struct {
+	ns         string
+	oplog      bool
+	resume     mongoResume
+	resumeFile string
+	out        chan<- *event.Event
+	acks       *ackWindow
+	checkpoint time.Duration
+	lastSave   time.Time
+}
+
+func newMongoTailer(ns string, oplog bool, resume mongoResume, resumeFile string, out chan<- *event.Event) *mongoTailer {
+	return &mongoTailer{
+		ns:         ns,
+		oplog:      oplog,
+		resume:     resume,
+		resumeFile: resumeFile,
+		out:        out,
+		acks:       newAckWindow("mongodb "+ns, resume),
+		checkpoint: time.Second,
+	}
+}
+
+//query returns the selector continuing after the resume position
+func (t *mongoTailer) query() bson.M {
+	if t.oplog {
+		q := bson.M{"ns": t.ns}
+		if t.resume.TS > 0 {
+			q["ts"] = bson.M{"$gt": t.resume.TS}
+		}
+		return q
+	}
+	if len(t.resume.ID) > 0 {
+		return bson.M{"_id": bson.M{"$gt": t.resume.ID}}
+	}
+	return bson.M{}
+}
+
+//semiCook returns the event of document, with the mongodb metadata, and its position
+func (t *mongoTailer) semiCook(doc bson.M) (*event.Event, mongoResume, error) {
+	pos := t.resume
+	meta := map[string]interface{}{"ns": t.ns}
+	body := doc
+
+	if t.oplog {
+		if ts, ok := doc["ts"].(bson.MongoTimestamp); ok {
+			pos.TS = ts
+			meta["ts"] = ts
+		}
+		meta["op"] = doc["op"]
+		if o2, ok := doc["o2"]; ok {
+			meta["o2"] = o2
+		}
+		body, _ = doc["o"].(bson.M)
+		if body == nil {
+			body = bson.M{}
+		}
+	} else if id, ok := doc["_id"].(bson.ObjectId); ok {
+		pos.ID = id
+	}
+
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return nil, pos, err
+	}
+	e := event.New(bs)
+	e.Meta["mongodb"] = meta
+	return e, pos, nil
+}
+
+//save persist the position of the last event every output settled
+func (t *mongoTailer) save() {
+	if err := saveMongoResume(t.resumeFile, t.acks.checkpoint().(mongoResume)); err != nil {
+		log.Printf("Can't save mongodb resume position to %s: %s", t.resumeFile, err.Error())
+	}
+	t.lastSave = time.Now()
+}
+
+//tail hand every document to out channel until the cursor dies, the position of an event
+//is checkpointed once every output settled it
+func (t *mongoTailer) tail(iter mongoIter) error {
+	for {
+		var doc bson.M
+		for iter.Next(&doc) {
+			e, pos, err := t.semiCook(doc)
+			seq := t.acks.add(pos)
+			if err == nil {
+				e.SetAck(func(err error) { t.acks.ack(seq, err) })
+				t.out <- e
+			} else {
+				log.Printf("Drop mongodb document from %s: %s", t.ns, err.Error())
+				t.acks.ack(seq, nil)
+			}
+			// the cursor goes on from the last document read, a restart from the checkpoint
+			t.resume = pos
+			if time.Since(t.lastSave) >= t.checkpoint {
+				t.save()
+			}
+			doc = nil
+		}
+		t.save()
+		if !iter.Timeout() {
+			break
+		}
+	}
+	return iter.Close()
+}
+
+//TailMongo follow the configured oplog namespace or capped collection forever
+func TailMongo(out chan<- *event.Event) {
+	cfg := g.Config().Pull.Mongo
+	session, err := mgo.Dial(cfg.URL)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer session.Close()
+	session.SetMode(mgo.Monotonic, true)
+
+	resume, err := loadMongoResume(cfg.ResumeFile)
+	if err != nil {
+		log.Panic(err)
+	}
+	if cfg.Oplog && resume.TS == 0 {
+		// the oplog keeps history, only follow what happens from now on
+		resume.TS = bson.MongoTimestamp(time.Now().Unix() << 32)
+	}
+
+	t := newMongoTailer(cfg.Database+"."+cfg.Collection, cfg.Oplog, resume, cfg.ResumeFile, out)
+
+	coll := session.DB(cfg.Database).C(cfg.Collection)
+	if cfg.Oplog {
+		coll = session.DB("local").C("oplog.rs")
+	}
+	log.Printf("Tail mongodb %s from %#v ...", t.ns, t.resume)
+
+	for {
+		q := coll.Find(t.query()).Sort("$natural")
+		if cfg.Oplog {
+			q = q.LogReplay()
+		}
+		if err := t.tail(q.Tail(mongoTailTimeout)); err != nil {
+			log.Printf("Tail mongodb %s failed: %s", t.ns, err.Error())
+			session.Refresh()
+		}
+		time.Sleep(time.Second)
+	}
+}
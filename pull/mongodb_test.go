@@ -0,0 +1,126 @@
+package pull
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/event"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type fakeIter struct {
+	docs    []bson.M
+	timeout bool
+}
+
+func (it *fakeIter) Next(result interface{}) bool {
+	if len(it.docs) == 0 {
+		return false
+	}
+	*(result.(*bson.M)) = it.docs[0]
+	it.docs = it.docs[1:]
+	return true
+}
+
+func (it *fakeIter) Timeout() bool {
+	// time out once so the tailer drains again, then the cursor dies
+	t := it.timeout
+	it.timeout = false
+	return t
+}
+
+func (it *fakeIter) Close() error { return nil }
+
+func TestMongoResume(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mongodb.resume")
+
+	r, err := loadMongoResume(path)
+	if err != nil || r.TS != 0 {
+		t.Fatalf("missing file should load a zero position: %#v, %v", r, err)
+	}
+
+	want := mongoResume{TS: bson.MongoTimestamp(6322049126420725761)}
+	if err := saveMongoResume(path, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadMongoResume(path); err != nil || got != want {
+		t.Errorf("loadMongoResume = %#v, %v, but we want %#v", got, err, want)
+	}
+}
+
+func TestMongoTailOplog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "yfstream")
+	defer os.RemoveAll(dir)
+
+	out := make(chan *event.Event, 4)
+	tailer := newMongoTailer("metadata.http", true, mongoResume{}, filepath.Join(dir, "mongodb.resume"), out)
+	tailer.checkpoint = time.Hour
+	iter := &fakeIter{
+		docs: []bson.M{
+			{"ts": bson.MongoTimestamp(1 << 32), "op": "i", "ns": "metadata.http", "o": bson.M{"type": "http"}},
+			{"ts": bson.MongoTimestamp(2 << 32), "op": "i", "ns": "metadata.http", "o": bson.M{"type": "dns"}},
+		},
+		timeout: true,
+	}
+
+	if err := tailer.tail(iter); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("got %d events, but we want 2", len(out))
+	}
+	e1, e2 := <-out, <-out
+	if tp, _ := e1.String("type"); tp != "http" {
+		t.Errorf("type = %q, but we want %q", tp, "http")
+	}
+	if op, _ := e1.Get([]string{event.MetadataKey, "mongodb", "op"}); op != "i" {
+		t.Errorf("mongodb.op = %q, but we want %q", op, "i")
+	}
+
+	// only the positions every output settled are checkpointed, in order
+	var tests = []struct {
+		done *event.Event
+		want bson.MongoTimestamp
+	}{
+		{nil, 0},
+		{e2, 0},
+		{e1, 2 << 32},
+	}
+	for _, tt := range tests {
+		if tt.done != nil {
+			tt.done.Done(nil)
+		}
+		tailer.save()
+		if r, _ := loadMongoResume(tailer.resumeFile); r.TS != tt.want {
+			t.Errorf("resume ts = %d, but we want %d", r.TS, tt.want)
+		}
+	}
+	if q := tailer.query(); q["ts"].(bson.M)["$gt"] != bson.MongoTimestamp(2<<32) {
+		t.Errorf("query = %#v does not continue after the resume position", q)
+	}
+}
+
+func TestMongoTailCapped(t *testing.T) {
+	out := make(chan *event.Event, 1)
+	tailer := newMongoTailer("metadata.events", false, mongoResume{}, "", out)
+	id := bson.ObjectIdHex("57bab5a5e4b0b4b7b7e0c3a1")
+	iter := &fakeIter{docs: []bson.M{{"_id": id, "type": "http"}}}
+
+	if q := tailer.query(); len(q) != 0 {
+		t.Errorf("query = %#v, but we want an empty selector", q)
+	}
+	tailer.tail(iter)
+	if tailer.resume.ID != id {
+		t.Errorf("resume id = %q, but we want %q", tailer.resume.ID.Hex(), id.Hex())
+	}
+	(<-out).Done(errors.New("sink down"))
+	if r := tailer.acks.checkpoint().(mongoResume); len(r.ID) != 0 {
+		t.Errorf("checkpoint id = %q, but we want none after a failed delivery", r.ID.Hex())
+	}
+}
@@ -1 +1,92 @@
 package pull
+
+import (
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"github.com/nsqio/go-nsq"
+	"log"
+	"time"
+)
+
+// how long a message may wait for room in the pipeline before it is requeued
+var nsqHandoffTimeout = 5 * time.Second
+
+//SemiCookNSQMsg wrap the message in an event with the nsq metadata
+func SemiCookNSQMsg(msg *nsq.Message, topic, channel string) *event.Event {
+	e := event.New(msg.Body)
+	e.Meta["nsq"] = map[string]interface{}{
+		"topic":    topic,
+		"channel":  channel,
+		"id":       string(msg.ID[:]),
+		"attempts": msg.Attempts,
+		"nsqd":     msg.NSQDAddress,
+	}
+	return e
+}
+
+type nsqHandler struct {
+	topic   string
+	channel string
+	out     chan<- *event.Event
+	timeout time.Duration
+}
+
+//HandleMessage FIN the message once every output settled it, REQ it when one failed
+//or when the pipeline has no room for it
+func (h *nsqHandler) HandleMessage(msg *nsq.Message) error {
+	msg.DisableAutoResponse()
+
+	e := SemiCookNSQMsg(msg, h.topic, h.channel)
+	e.SetAck(func(err error) {
+		if err != nil {
+			msg.Requeue(-1)
+			return
+		}
+		msg.Finish()
+	})
+
+	select {
+	case h.out <- e:
+	case <-time.After(h.timeout):
+		msg.Requeue(-1)
+	}
+	return nil
+}
+
+//InitNSQConsumer returns a nsq consumer feeding messages to out channel
+func InitNSQConsumer(out chan<- *event.Event) *nsq.Consumer {
+	cfg := g.Config().Pull.NSQ
+
+	nsqConfig := nsq.NewConfig()
+	if cfg.MaxInFlight > 0 {
+		nsqConfig.MaxInFlight = cfg.MaxInFlight
+	}
+	if cfg.MaxAttempts > 0 {
+		nsqConfig.MaxAttempts = cfg.MaxAttempts
+	}
+
+	consumer, err := nsq.NewConsumer(cfg.Topic, cfg.Channel, nsqConfig)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	h := &nsqHandler{
+		topic:   cfg.Topic,
+		channel: cfg.Channel,
+		out:     out,
+		timeout: nsqHandoffTimeout,
+	}
+	consumer.AddConcurrentHandlers(h, nsqConfig.MaxInFlight)
+
+	if len(cfg.Lookupds) > 0 {
+		err = consumer.ConnectToNSQLookupds(cfg.Lookupds)
+	} else {
+		err = consumer.ConnectToNSQDs(cfg.Nsqds)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Println("Init nsq consumer done ...")
+
+	return consumer
+}
@@ -0,0 +1,80 @@
+package pull
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/nsqio/go-nsq"
+)
+
+type fakeDelegate struct {
+	finished int
+	requeued int
+}
+
+func (d *fakeDelegate) OnFinish(m *nsq.Message)                                 { d.finished++ }
+func (d *fakeDelegate) OnRequeue(m *nsq.Message, t time.Duration, backoff bool) { d.requeued++ }
+func (d *fakeDelegate) OnTouch(m *nsq.Message)                                  {}
+
+func newFakeMessage(body string) (*nsq.Message, *fakeDelegate) {
+	var id nsq.MessageID
+	copy(id[:], "0123456789abcdef")
+	d := &fakeDelegate{}
+	msg := nsq.NewMessage(id, []byte(body))
+	msg.Delegate = d
+	return msg, d
+}
+
+func TestNSQHandlerFinish(t *testing.T) {
+	out := make(chan *event.Event, 1)
+	h := &nsqHandler{topic: "packetbeat", channel: "yfstream", out: out, timeout: time.Second}
+	msg, d := newFakeMessage(`{"type": "http"}`)
+
+	h.HandleMessage(msg)
+	if d.finished != 0 || d.requeued != 0 {
+		t.Fatalf("finished = %d, requeued = %d before the ack, but we want 0, 0", d.finished, d.requeued)
+	}
+
+	e := <-out
+	if topic, _ := e.Get([]string{event.MetadataKey, "nsq", "topic"}); topic != "packetbeat" {
+		t.Errorf("@metadata.nsq.topic = %v, but we want %q", topic, "packetbeat")
+	}
+	if channel, _ := e.Get([]string{event.MetadataKey, "nsq", "channel"}); channel != "yfstream" {
+		t.Errorf("@metadata.nsq.channel = %v, but we want %q", channel, "yfstream")
+	}
+	if _, ok := e.Get([]string{"nsq"}); ok {
+		t.Errorf("nsq metadata should not be in the payload")
+	}
+	e.Done(nil)
+	if d.finished != 1 || d.requeued != 0 {
+		t.Fatalf("finished = %d, requeued = %d, but we want 1, 0", d.finished, d.requeued)
+	}
+}
+
+func TestNSQHandlerRequeue(t *testing.T) {
+	out := make(chan *event.Event)
+	h := &nsqHandler{topic: "packetbeat", channel: "yfstream", out: out, timeout: 10 * time.Millisecond}
+	msg, d := newFakeMessage(`{"type": "http"}`)
+
+	h.HandleMessage(msg)
+	if d.finished != 0 || d.requeued != 1 {
+		t.Fatalf("finished = %d, requeued = %d, but we want 0, 1", d.finished, d.requeued)
+	}
+}
+
+func TestNSQHandlerNotDelivered(t *testing.T) {
+	out := make(chan *event.Event, 1)
+	h := &nsqHandler{topic: "packetbeat", channel: "yfstream", out: out, timeout: time.Second}
+	msg, d := newFakeMessage(`{"type": "http"}`)
+
+	h.HandleMessage(msg)
+	e := <-out
+	e.Hold(1)
+	e.Done(nil)
+	e.Done(errors.New("sink down"))
+	if d.finished != 0 || d.requeued != 1 {
+		t.Fatalf("finished = %d, requeued = %d, but we want 0, 1", d.finished, d.requeued)
+	}
+}
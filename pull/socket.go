@@ -1 +1,145 @@
 package pull
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/chenyoufu/yfstream/codec"
+	"github.com/chenyoufu/yfstream/event"
+	"github.com/chenyoufu/yfstream/g"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+)
+
+//SemiCookSocketMsg wrap message in an event with the socket metadata
+func SemiCookSocketMsg(msg []byte, network, peer string) *event.Event {
+	e := event.New(msg)
+	e.Meta["socket"] = map[string]interface{}{"network": network, "peer": peer}
+	return e
+}
+
+//newServerTLSConfig load the server certificate, clients are verified when a CA is set
+func newServerTLSConfig(cfg g.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if len(cfg.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+//handOff semi-cook one frame and send it to out channel
+func handOff(out chan<- *event.Event, msg []byte, network, peer string) {
+	out <- SemiCookSocketMsg(msg, network, peer)
+}
+
+//ServeStream decode frames from every accepted connection until the listener is closed
+func ServeStream(ln net.Listener, c codec.Codec, out chan<- *event.Event) error {
+	network := ln.Addr().Network()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			peer := conn.RemoteAddr().String()
+			r := bufio.NewReader(conn)
+			for {
+				msg, err := c.Decode(r)
+				if err != nil {
+					if err != io.EOF {
+						log.Printf("Close socket connection from %s: %s", peer, err.Error())
+					}
+					return
+				}
+				handOff(out, msg, network, peer)
+			}
+		}(conn)
+	}
+}
+
+//ServePacket decode the frames of every datagram until the connection is closed
+func ServePacket(pc net.PacketConn, c codec.Codec, out chan<- *event.Event) error {
+	network := pc.LocalAddr().Network()
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		peer := ""
+		if addr != nil {
+			peer = addr.String()
+		}
+		r := bufio.NewReader(bytes.NewReader(buf[:n]))
+		for {
+			msg, err := c.Decode(r)
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("Drop datagram from %s: %s", peer, err.Error())
+				}
+				break
+			}
+			handOff(out, msg, network, peer)
+		}
+	}
+}
+
+//ListenSocket accept framed messages on the configured socket and feed them to out channel
+func ListenSocket(out chan<- *event.Event) {
+	cfg := g.Config().Pull.Socket
+	c, err := codec.New(cfg.Framing, cfg.MaxFrameSize)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	switch cfg.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		if cfg.Network == "unixgram" {
+			os.Remove(cfg.Address)
+		}
+		pc, err := net.ListenPacket(cfg.Network, cfg.Address)
+		if err != nil {
+			log.Panic(err)
+		}
+		log.Printf("Listen socket %s://%s done ...", cfg.Network, cfg.Address)
+		err = ServePacket(pc, c, out)
+		log.Printf("Socket %s://%s closed: %s", cfg.Network, cfg.Address, err.Error())
+	default:
+		if cfg.Network == "unix" {
+			os.Remove(cfg.Address)
+		}
+		ln, err := net.Listen(cfg.Network, cfg.Address)
+		if err != nil {
+			log.Panic(err)
+		}
+		if cfg.TLS.Enabled {
+			tc, err := newServerTLSConfig(cfg.TLS)
+			if err != nil {
+				log.Panic(err)
+			}
+			ln = tls.NewListener(ln, tc)
+		}
+		log.Printf("Listen socket %s://%s done ...", cfg.Network, cfg.Address)
+		err = ServeStream(ln, c, out)
+		log.Printf("Socket %s://%s closed: %s", cfg.Network, cfg.Address, err.Error())
+	}
+}
@@ -0,0 +1,123 @@
+package pull
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chenyoufu/yfstream/codec"
+	"github.com/chenyoufu/yfstream/event"
+)
+
+//receive returns the payload of the next n events of out
+func receive(t *testing.T, out <-chan *event.Event, n int) []string {
+	var got []string
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-out:
+			b, _ := e.Bytes()
+			got = append(got, string(b))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %q, but we want %d events", got, n)
+		}
+	}
+	return got
+}
+
+func TestServeStream(t *testing.T) {
+	msgs := []string{`{"type":"http"}`, `{"type":"dns"}`}
+	var tests = []struct {
+		framing string
+		input   func(c codec.Codec) []byte
+		want    []string
+	}{
+		{"newline", func(codec.Codec) []byte { return []byte("{\"type\":\"http\"}\n{\"type\":\"dns\"}\n") }, msgs},
+		{"newline", func(codec.Codec) []byte { return []byte("{\"type\":\"http\"}\r\n{\"type\":\"dns\"}\r\n") }, msgs},
+		// the peer closes after an unterminated CRLF line
+		{"newline", func(codec.Codec) []byte { return []byte("{\"type\":\"http\"}\r\n{\"type\":\"dns\"}\r") }, msgs},
+		{"newline", func(codec.Codec) []byte { return []byte("{\"type\":\"http\"}\n{\"type\":\"dns\"}") }, msgs},
+		{"octet", encodeAll(msgs), msgs},
+		{"length", encodeAll(msgs), msgs},
+	}
+	for _, tt := range tests {
+		c, err := codec.New(tt.framing, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(chan *event.Event, len(tt.want))
+		go ServeStream(ln, c, out)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := tt.input(c)
+		conn.Write(input)
+		conn.Close()
+
+		got := receive(t, out, len(tt.want))
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: ServeStream(%q) event %d = %q, but we want %q", tt.framing, input, i, got[i], tt.want[i])
+			}
+		}
+		ln.Close()
+	}
+}
+
+func TestServePacket(t *testing.T) {
+	msgs := []string{`{"type":"http"}`, `{"type":"dns"}`}
+	for _, framing := range []string{"newline", "octet", "length"} {
+		c, _ := codec.New(framing, 0)
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(chan *event.Event, len(msgs))
+		go ServePacket(pc, c, out)
+
+		conn, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(encodeAll(msgs)(c))
+		conn.Close()
+
+		got := receive(t, out, len(msgs))
+		for i := range msgs {
+			if got[i] != msgs[i] {
+				t.Errorf("%s: ServePacket event %d = %q, but we want %q", framing, i, got[i], msgs[i])
+			}
+		}
+		pc.Close()
+	}
+}
+
+func TestSemiCookSocketMsg(t *testing.T) {
+	e := SemiCookSocketMsg([]byte(`{"type":"http"}`), "tcp", "10.0.0.1:5000")
+	if peer, _ := e.Get([]string{event.MetadataKey, "socket", "peer"}); peer != "10.0.0.1:5000" {
+		t.Errorf("@metadata.socket.peer = %v, but we want 10.0.0.1:5000", peer)
+	}
+	if network, _ := e.Get([]string{event.MetadataKey, "socket", "network"}); network != "tcp" {
+		t.Errorf("@metadata.socket.network = %v, but we want tcp", network)
+	}
+	if _, ok := e.Get([]string{"socket"}); ok {
+		t.Errorf("socket metadata should not be in the payload")
+	}
+}
+
+//encodeAll returns the frames of msgs in the framing of c
+func encodeAll(msgs []string) func(c codec.Codec) []byte {
+	return func(c codec.Codec) []byte {
+		var buf bytes.Buffer
+		for _, m := range msgs {
+			c.Encode(&buf, []byte(m))
+		}
+		return buf.Bytes()
+	}
+}